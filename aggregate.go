@@ -0,0 +1,54 @@
+package main
+
+import (
+	"maps"
+	"sync"
+)
+
+// aggregator tallies the results of a scan for its summary: the findings
+// per classification and, with -extension-stats, the listed objects per
+// extension. It is safe for concurrent use, so the counts stay exact
+// whichever goroutines feed it.
+type aggregator struct {
+	mu         sync.Mutex
+	counts     map[string]int
+	extensions map[string]int
+}
+
+// newAggregator returns an empty aggregator. The extension histogram is only
+// kept with extensionStats.
+func newAggregator(extensionStats bool) *aggregator {
+	a := &aggregator{counts: make(map[string]int)}
+	if extensionStats {
+		a.extensions = make(map[string]int)
+	}
+	return a
+}
+
+// addExtensions merges the extension histogram of a result's listing.
+func (a *aggregator) addExtensions(r Result) {
+	if a.extensions == nil || len(r.extensions) == 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for ext, n := range r.extensions {
+		a.extensions[ext] += n
+	}
+}
+
+// count tallies a reported finding under its classification.
+func (a *aggregator) count(r Result) {
+	a.mu.Lock()
+	a.counts[r.Classification]++
+	a.mu.Unlock()
+}
+
+// fill copies the tallies so far into sum.
+func (a *aggregator) fill(sum *Summary) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sum.Counts = maps.Clone(a.counts)
+	sum.Extensions = maps.Clone(a.extensions)
+	sum.Errors = a.counts[ClassError]
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestAggregatorConcurrentScan feeds the aggregator from several consumers
+// while discovery and listing workers probe a local server. Run under go
+// test -race, it checks that the results reach it without data races and
+// that its counts and extension histogram match the findings exactly.
+func TestAggregatorConcurrentScan(t *testing.T) {
+	const buckets = 600
+	// bucket-N is listable over two pages when N%3 == 0, private when
+	// N%3 == 1 and missing otherwise.
+	s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _ := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"), "/o")
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "bucket-"))
+		switch {
+		case err == nil && n%3 == 0:
+			if r.URL.Query().Get("pageToken") == "" {
+				fmt.Fprint(w, `{"items":[{"name":"a.csv"},{"name":"b.txt"}],"nextPageToken":"p2"}`)
+			} else {
+				fmt.Fprint(w, `{"items":[{"name":"c.csv"}]}`)
+			}
+		case err == nil && n%3 == 1:
+			gcsError(w, http.StatusForbidden, "forbidden", "Anonymous caller does not have storage.objects.list access")
+		default:
+			gcsError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+		}
+	}), clientOptions{Workers: 16})
+	s.extensionStats = true
+	s.listQueue = make(chan listJob, 4)
+
+	names := make(chan string)
+	go func() {
+		defer close(names)
+		for i := range buckets {
+			names <- fmt.Sprintf("bucket-%d", i)
+		}
+	}()
+	output := make(chan Result)
+	agg := newAggregator(true)
+	var workers, listers, consumers sync.WaitGroup
+	for range 16 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for name := range names {
+				s.checkBucket(candidate{Name: name, Keyword: name}, output)
+			}
+		}()
+	}
+	for range 4 {
+		listers.Add(1)
+		go func() {
+			defer listers.Done()
+			s.listWorker(output)
+		}()
+	}
+	for range 4 {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for r := range output {
+				agg.addExtensions(r)
+				agg.count(r)
+			}
+		}()
+	}
+	workers.Wait()
+	close(s.listQueue)
+	listers.Wait()
+	close(output)
+	consumers.Wait()
+
+	var sum Summary
+	agg.fill(&sum)
+	if want := map[string]int{ClassListable: buckets / 3, ClassExists: buckets / 3}; !maps.Equal(sum.Counts, want) {
+		t.Errorf("counts %v, want %v", sum.Counts, want)
+	}
+	if want := map[string]int{".csv": 2 * buckets / 3, ".txt": buckets / 3}; !maps.Equal(sum.Extensions, want) {
+		t.Errorf("extensions %v, want %v", sum.Extensions, want)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "hash/fnv"
+
+// bloomHashes is the number of bit positions set per name. Seven is optimal
+// at about ten bits per name, where the false positive rate is near 1%.
+const bloomHashes = 7
+
+// bloomFilter is a fixed-size set membership filter. It never misses a name
+// it has seen, but may wrongly report an unseen name as seen; in the
+// candidate stream such a name is skipped.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+}
+
+func newBloomFilter(sizeBytes int64) *bloomFilter {
+	words := max(sizeBytes/8, 1)
+	return &bloomFilter{bits: make([]uint64, words), m: uint64(words) * 64}
+}
+
+// positions derives the bit positions of name by double hashing two
+// independent FNV hashes.
+func (b *bloomFilter) positions(name string, fn func(uint64)) {
+	h1 := fnv.New64a()
+	h1.Write([]byte(name))
+	h2 := fnv.New64()
+	h2.Write([]byte(name))
+	a, c := h1.Sum64(), h2.Sum64()|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		fn((a + i*c) % b.m)
+	}
+}
+
+// testAndAdd adds name and reports whether it (probably) was present.
+func (b *bloomFilter) testAndAdd(name string) bool {
+	present := true
+	b.positions(name, func(pos uint64) {
+		word, bit := pos/64, uint64(1)<<(pos%64)
+		if b.bits[word]&bit == 0 {
+			present = false
+			b.bits[word] |= bit
+		}
+	})
+	return present
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CDNInfo describes the caching layer seen in front of a bucket's content.
+// Cached copies can stay reachable after a bucket is locked down, so this
+// affects how public the data effectively is.
+type CDNInfo struct {
+	// Cached is set when a response came from an edge cache rather than
+	// the bucket itself.
+	Cached       bool     `json:"cached"`
+	CacheControl string   `json:"cache_control,omitempty"`
+	Signals      []string `json:"signals"`
+}
+
+// cdnSignals extracts the headers that indicate a response passed through
+// Cloud CDN or Google's edge cache. It reports whether any of them show the
+// response was actually served from a cache.
+func cdnSignals(h http.Header) (signals []string, cached bool) {
+	if via := h.Get("Via"); strings.Contains(strings.ToLower(via), "google") {
+		signals = append(signals, "via: "+via)
+		cached = true
+	}
+	if age := h.Get("Age"); age != "" {
+		signals = append(signals, "age: "+age)
+		cached = true
+	}
+	for _, name := range []string{"X-Cache", "X-Cache-Status", "Cdn-Cache-Status"} {
+		if v := h.Get(name); strings.Contains(strings.ToUpper(v), "HIT") {
+			signals = append(signals, strings.ToLower(name)+": "+v)
+			cached = true
+		}
+	}
+	if cc := h.Get("Cache-Control"); strings.Contains(cc, "public") {
+		signals = append(signals, "cache-control: "+cc)
+	}
+	if h.Get("X-GUploader-UploadID") != "" {
+		signals = append(signals, "x-guploader-uploadid")
+	}
+	return signals, cached
+}
+
+// noteCDN merges the CDN signals of one response into result. Only public
+// caching or an actual cache hit is recorded; the GCS origin header alone
+// is not worth a mention.
+func noteCDN(result *Result, h http.Header) {
+	signals, cached := cdnSignals(h)
+	cc := h.Get("Cache-Control")
+	if !cached && !strings.Contains(cc, "public") {
+		return
+	}
+	if result.CDN == nil {
+		result.CDN = &CDNInfo{}
+	}
+	result.CDN.Cached = result.CDN.Cached || cached
+	if strings.Contains(cc, "public") {
+		result.CDN.CacheControl = cc
+	}
+	for _, s := range signals {
+		if !slices.Contains(result.CDN.Signals, s) {
+			result.CDN.Signals = append(result.CDN.Signals, s)
+		}
+	}
+}
+
+// String renders the CDN details compactly for text output.
+func (c *CDNInfo) String() string {
+	state := "publicly cacheable"
+	if c.Cached {
+		state = "served from cache"
+	}
+	return state + " (" + strings.Join(c.Signals, ", ") + ")"
+}
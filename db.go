@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// findingsSchema keeps one row per bucket and kind of finding; re-runs
+// update it in place so first_seen and last_seen bracket the time a bucket
+// has been observed. The kind keeps the side findings of a bucket, such as
+// an endpoint mismatch, from overwriting the classification of its probe.
+const findingsSchema = `CREATE TABLE IF NOT EXISTS findings (
+	bucket         TEXT NOT NULL,
+	kind           TEXT NOT NULL,
+	classification TEXT NOT NULL,
+	http_status    INTEGER,
+	object_count   INTEGER,
+	first_seen     TEXT NOT NULL,
+	last_seen      TEXT NOT NULL,
+	scan_id        TEXT NOT NULL,
+	PRIMARY KEY (bucket, kind)
+)`
+
+const upsertFinding = `INSERT INTO findings (bucket, kind, classification, http_status, object_count, first_seen, last_seen, scan_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (bucket, kind) DO UPDATE SET
+	classification = excluded.classification,
+	http_status = excluded.http_status,
+	object_count = excluded.object_count,
+	last_seen = excluded.last_seen,
+	scan_id = excluded.scan_id`
+
+// findingStore records findings in a SQLite database for -db. It is only
+// used from the consumer goroutine.
+type findingStore struct {
+	db     *sql.DB
+	insert *sql.Stmt
+	scanID string
+}
+
+// newScanID returns a random identifier tying the findings, summary,
+// manifest and database rows of one run together.
+func newScanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func openFindingStore(path, scanID string) (*findingStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(findingsSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	insert, err := db.Prepare(upsertFinding)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &findingStore{db: db, insert: insert, scanID: scanID}, nil
+}
+
+// findingKind tells the probe result of a bucket apart from its side
+// findings: the CNAME of a custom domain and the endpoint comparisons.
+func findingKind(r Result) string {
+	switch {
+	case r.Classification == ClassCustomDomain:
+		return "custom_domain"
+	case r.Classification == ClassEndpointMismatch && r.Region != "":
+		return "region:" + r.Region
+	case r.Classification == ClassEndpointMismatch:
+		return "xml_endpoint"
+	}
+	return "probe"
+}
+
+// Record upserts r, keeping first_seen from an earlier run.
+func (f *findingStore) Record(r Result) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := f.insert.Exec(r.Bucket, findingKind(r), r.Classification, r.StatusCode, r.ObjectCount, now, now, f.scanID)
+	return err
+}
+
+// Previous returns the classification an earlier run stored for the bucket
+// and kind of finding of r, and when it was last seen.
+func (f *findingStore) Previous(r Result) (class string, lastSeen time.Time, ok bool) {
+	var seen string
+	err := f.db.QueryRow(`SELECT classification, last_seen FROM findings WHERE bucket = ? AND kind = ? AND scan_id != ?`, r.Bucket, findingKind(r), f.scanID).Scan(&class, &seen)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	lastSeen, _ = time.Parse(time.RFC3339, seen)
+	return class, lastSeen, true
+}
+
+func (f *findingStore) Close() error {
+	f.insert.Close()
+	return f.db.Close()
+}
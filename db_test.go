@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFindingStoreKeepsProbeRowPerKind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "findings.sqlite")
+	first, err := openFindingStore(path, "scan-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Record(Result{Bucket: "acme", Classification: ClassExists, StatusCode: 403}); err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	// The next run reports the side findings of the bucket before its
+	// probe result, which must still be compared with the stored probe.
+	second, err := openFindingStore(path, "scan-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	for _, r := range []Result{
+		{Bucket: "acme", Classification: ClassCustomDomain},
+		{Bucket: "acme", Classification: ClassEndpointMismatch, XMLStatus: 200},
+		{Bucket: "acme", Classification: ClassEndpointMismatch, Region: "us-east1"},
+	} {
+		if _, _, ok := second.Previous(r); ok {
+			t.Errorf("%s has a previous row before it was recorded", findingKind(r))
+		}
+		if err := second.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	class, _, ok := second.Previous(Result{Bucket: "acme", Classification: ClassListable})
+	if !ok || class != ClassExists {
+		t.Errorf("previous probe classification %q (found %v), want %s", class, ok, ClassExists)
+	}
+	var rows int
+	second.db.QueryRow(`SELECT COUNT(*) FROM findings WHERE bucket = 'acme'`).Scan(&rows)
+	if rows != 4 {
+		t.Errorf("%d rows for the bucket, want 4", rows)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// downloadEntry is one line of a bucket's download manifest: an object
+// fetched completely, with the size and base64 MD5 of the local copy.
+type downloadEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	MD5  string `json:"md5"`
+}
+
+// downloadManifestPath returns where the download manifest of bucket is
+// kept, next to the directory its objects are saved in.
+func downloadManifestPath(dir, bucket string) string {
+	return filepath.Join(dir, bucket+".manifest.ndjson")
+}
+
+// readDownloadManifest returns the entries of a download manifest by object
+// name. A missing manifest is empty, and a line cut short by an interrupted
+// run is ignored.
+func readDownloadManifest(path string) (map[string]downloadEntry, error) {
+	entries := make(map[string]downloadEntry)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var entry downloadEntry
+		if json.Unmarshal(lines.Bytes(), &entry) == nil && entry.Name != "" {
+			entries[entry.Name] = entry
+		}
+	}
+	return entries, lines.Err()
+}
+
+// present reports whether the local copy at path still matches the entry,
+// so a resumed download can skip it.
+func (e downloadEntry) present(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	h := md5.New()
+	n, err := io.Copy(h, file)
+	return err == nil && n == e.Size && base64.StdEncoding.EncodeToString(h.Sum(nil)) == e.MD5
+}
+
+// downloadObjects saves the objects listed in a LISTABLE finding under
+// s.downloadDir/<bucket>, appending each one to the bucket's manifest as
+// soon as it is complete. Objects the manifest already holds are skipped
+// when their local copy still has the recorded size and MD5, so a scan run
+// again resumes an interrupted download. Names that would land outside the
+// bucket's directory are never written.
+func (s *scanner) downloadObjects(result *Result) {
+	if s.downloadDir == "" || result.Classification != ClassListable || len(result.Objects) == 0 {
+		return
+	}
+	path := downloadManifestPath(s.downloadDir, result.Bucket)
+	done, err := readDownloadManifest(path)
+	if err != nil {
+		slog.Warn("Could not read download manifest", "path", path, "err", err)
+		return
+	}
+	if err := os.MkdirAll(s.downloadDir, 0o755); err != nil {
+		slog.Warn("Could not create download directory", "path", s.downloadDir, "err", err)
+		return
+	}
+	manifest, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		slog.Warn("Could not open download manifest", "path", path, "err", err)
+		return
+	}
+	defer manifest.Close()
+	enc := json.NewEncoder(manifest)
+
+	root := filepath.Join(s.downloadDir, result.Bucket)
+	for _, name := range result.Objects {
+		if strings.HasSuffix(name, "/") || !filepath.IsLocal(filepath.FromSlash(name)) {
+			slog.Debug("Not downloading object", "bucket", result.Bucket, "object", name)
+			continue
+		}
+		local := filepath.Join(root, filepath.FromSlash(name))
+		if entry, ok := done[name]; ok && entry.present(local) {
+			result.Resumed++
+			continue
+		}
+		entry, err := s.downloadObject(result.Bucket, name, local)
+		if err != nil {
+			slog.Warn("Could not download object", "bucket", result.Bucket, "object", name, "err", err)
+			continue
+		}
+		if err := enc.Encode(entry); err != nil {
+			slog.Warn("Could not update download manifest", "path", path, "err", err)
+		}
+		result.Downloaded++
+	}
+}
+
+// downloadObject fetches one object to local. It is written to a temporary
+// file first, so an interrupted transfer never leaves a truncated copy under
+// the object's name, and checked against the MD5 in the x-goog-hash header
+// when the server sends one.
+func (s *scanner) downloadObject(bucket, name, local string) (downloadEntry, error) {
+	resp, err := s.getAs(classDownload, objectURL(bucket, name))
+	if err != nil {
+		return downloadEntry{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		io.Copy(io.Discard, resp.Body)
+		return downloadEntry{}, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return downloadEntry{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(local), ".gcpenum-download-*")
+	if err != nil {
+		return downloadEntry{}, err
+	}
+	h := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	sum := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if want := headerMD5(resp.Header); err == nil && want != "" && want != sum {
+		err = fmt.Errorf("MD5 %s does not match the %s the server reported", sum, want)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), local)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return downloadEntry{}, err
+	}
+	return downloadEntry{Name: name, Size: size, MD5: sum}, nil
+}
+
+// headerMD5 returns the base64 MD5 from the x-goog-hash headers of an object
+// response, or "" for composite objects, which only carry a CRC32C.
+func headerMD5(header http.Header) string {
+	for _, value := range header.Values("X-Goog-Hash") {
+		for _, part := range strings.Split(value, ",") {
+			if sum, ok := strings.CutPrefix(strings.TrimSpace(part), "md5="); ok {
+				return sum
+			}
+		}
+	}
+	return ""
+}
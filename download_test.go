@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadObjectsResumes(t *testing.T) {
+	quietLogs(t)
+	objects := map[string]string{"a.txt": "alpha", "dir/b.csv": "b,c\n", "../escape": "outside"}
+	var fetched atomic.Int32
+	s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/storage/v1/b/acme/o" {
+			fmt.Fprint(w, `{"items":[{"name":"a.txt"},{"name":"dir/b.csv"},{"name":"dir/"},{"name":"../escape"}]}`)
+			return
+		}
+		body, ok := objects[strings.TrimPrefix(r.URL.Path, "/acme/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fetched.Add(1)
+		sum := md5.Sum([]byte(body))
+		w.Header().Set("X-Goog-Hash", "crc32c=AAAAAA==,md5="+base64.StdEncoding.EncodeToString(sum[:]))
+		fmt.Fprint(w, body)
+	}), clientOptions{})
+	dir := t.TempDir()
+	s.downloadDir = filepath.Join(dir, "evidence")
+
+	run := func() Result {
+		t.Helper()
+		fetched.Store(0)
+		results := checkOne(s, "acme")
+		if len(results) != 1 {
+			t.Fatalf("got %d results, want 1", len(results))
+		}
+		return results[0]
+	}
+
+	r := run()
+	if r.Downloaded != 2 || r.Resumed != 0 || fetched.Load() != 2 {
+		t.Fatalf("first run downloaded %d, resumed %d with %d fetches, want 2, 0 and 2", r.Downloaded, r.Resumed, fetched.Load())
+	}
+	for name, body := range map[string]string{"a.txt": "alpha", "dir/b.csv": "b,c\n"} {
+		if data, err := os.ReadFile(filepath.Join(s.downloadDir, "acme", name)); err != nil || string(data) != body {
+			t.Errorf("%s holds %q (%v), want %q", name, data, err, body)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(s.downloadDir, "escape")); err == nil {
+		t.Error("an object name escaping the bucket directory was written")
+	}
+
+	// A rerun skips what the manifest holds, and fetches again what no
+	// longer matches it.
+	r = run()
+	if r.Downloaded != 0 || r.Resumed != 2 || fetched.Load() != 0 {
+		t.Errorf("second run downloaded %d, resumed %d with %d fetches, want 0, 2 and 0", r.Downloaded, r.Resumed, fetched.Load())
+	}
+	if err := os.WriteFile(filepath.Join(s.downloadDir, "acme", "a.txt"), []byte("alp"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r = run()
+	if r.Downloaded != 1 || r.Resumed != 1 || fetched.Load() != 1 {
+		t.Errorf("run after truncation downloaded %d, resumed %d with %d fetches, want 1, 1 and 1", r.Downloaded, r.Resumed, fetched.Load())
+	}
+}
+
+func TestDownloadObjectRejectsMD5Mismatch(t *testing.T) {
+	s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Goog-Hash", "md5=AAAAAAAAAAAAAAAAAAAAAA==")
+		fmt.Fprint(w, "alpha")
+	}), clientOptions{})
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if _, err := s.downloadObject("acme", "a.txt", local); err == nil {
+		t.Error("object with a mismatching MD5 downloaded without error")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(local)); len(entries) != 0 {
+		t.Errorf("failed download left %d files behind", len(entries))
+	}
+}
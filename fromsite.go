@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxFromSiteBytes bounds how much of the -from-site page is read.
+const maxFromSiteBytes = 5 << 20
+
+// bucketRefPatterns match the ways a page can reference a bucket, with the
+// bucket name as the first group. The App Engine and Firebase host patterns
+// capture a project ID instead, standing for the project's default buckets.
+var (
+	bucketRefPatterns = []*regexp.Regexp{
+		// storage.googleapis.com/bucket, storage.cloud.google.com/bucket,
+		// but not firebasestorage.googleapis.com or a bucket's own host
+		regexp.MustCompile(`(?i)(?:^|[^a-z0-9.-])storage\.(?:googleapis|cloud\.google)\.com/([a-z0-9][a-z0-9._-]*[a-z0-9])`),
+		// bucket.storage.googleapis.com
+		regexp.MustCompile(`(?i)([a-z0-9][a-z0-9._-]*[a-z0-9])\.storage\.googleapis\.com`),
+		// JSON API and Firebase download URLs: .../b/bucket/o
+		regexp.MustCompile(`(?i)(?:googleapis\.com/(?:download/|upload/)?storage/v1|firebasestorage\.googleapis\.com/v0)/b/([a-z0-9][a-z0-9._-]*[a-z0-9])`),
+		regexp.MustCompile(`(?i)gs://([a-z0-9][a-z0-9._-]*[a-z0-9])`),
+	}
+	appspotPattern  = regexp.MustCompile(`(?i)([a-z0-9][a-z0-9-]*[a-z0-9])\.appspot\.com`)
+	firebasePattern = regexp.MustCompile(`(?i)([a-z0-9][a-z0-9-]*[a-z0-9])\.firebasestorage\.app`)
+)
+
+// notBuckets are path segments the path-style pattern picks up from API
+// URLs rather than bucket names.
+var notBuckets = map[string]bool{"storage": true, "download": true, "upload": true}
+
+// fetchSiteBuckets fetches a single page and returns the buckets referenced
+// by its HTML, inline scripts and Content-Security-Policy headers, each
+// attributed to the site's host. Links are not followed, but redirects are,
+// whatever -no-follow-redirects says, so an http:// or bare-domain URL
+// reaches the page it stands for.
+func fetchSiteBuckets(client *http.Client, siteURL string) ([]candidate, error) {
+	u, err := url.Parse(siteURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid -from-site %q (expected an http or https URL)", siteURL)
+	}
+	following := *client
+	following.CheckRedirect = nil
+	resp, err := following.Get(siteURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s returned status %d", siteURL, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFromSiteBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []string{string(body)}
+	for _, name := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only", "Link"} {
+		sources = append(sources, resp.Header.Values(name)...)
+	}
+	var candidates []candidate
+	for _, name := range bucketRefs(strings.Join(sources, "\n")) {
+		candidates = append(candidates, candidate{Name: name, Keyword: u.Hostname(), Explicit: true})
+	}
+	slog.Info("Collected bucket references from site", "url", siteURL, "buckets", len(candidates))
+	return candidates, nil
+}
+
+// bucketRefs returns the distinct bucket names referenced in text, in the
+// order first seen.
+func bucketRefs(text string) []string {
+	var names []string
+	add := func(name string) {
+		name = strings.ToLower(name)
+		if !notBuckets[name] && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, pattern := range bucketRefPatterns {
+		for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+			add(match[1])
+		}
+	}
+	for _, match := range appspotPattern.FindAllStringSubmatch(text, -1) {
+		for _, name := range appspotBuckets(match[1]) {
+			add(name)
+		}
+	}
+	for _, match := range firebasePattern.FindAllStringSubmatch(text, -1) {
+		add(match[1] + ".firebasestorage.app")
+	}
+	return names
+}
+
+// appspotBuckets returns the default buckets App Engine creates for the
+// project behind an appspot.com host. Service and version hosts name the
+// project after their last "-dot-".
+func appspotBuckets(host string) []string {
+	if i := strings.LastIndex(host, "-dot-"); i >= 0 {
+		host = host[i+len("-dot-"):]
+	}
+	return []string{host + ".appspot.com", "staging." + host + ".appspot.com"}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestFetchSiteBucketsFollowsRedirects(t *testing.T) {
+	quietLogs(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/www/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/www/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "img-src https://cdn-assets.storage.googleapis.com")
+		fmt.Fprint(w, `<script src="https://storage.googleapis.com/acme-static/app.js"></script> gs://acme-Raw/`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client, err := newHTTPClient(clientOptions{Workers: 1, NoFollowRedirects: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates, err := fetchSiteBuckets(client, srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range candidates {
+		names = append(names, c.Name)
+		if !c.Explicit || c.Keyword != "127.0.0.1" {
+			t.Errorf("%s: keyword %q, explicit %v", c.Name, c.Keyword, c.Explicit)
+		}
+	}
+	if want := []string{"acme-static", "cdn-assets", "acme-raw"}; !slices.Equal(names, want) {
+		t.Errorf("buckets %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FUSEInfo records the traces Cloud Storage FUSE leaves in a listing.
+// Buckets mounted with gcsfuse usually back an application's filesystem,
+// so their contents tend to be live data rather than archives.
+type FUSEInfo struct {
+	// DirMarkers counts zero-byte "dir/" objects, which gcsfuse creates
+	// for every mkdir. The console's "Create folder" makes them too, so
+	// they are a weak signal on their own.
+	DirMarkers int `json:"dir_markers,omitempty"`
+	// Tagged counts objects carrying gcsfuse's own custom metadata, such
+	// as the gcsfuse_mtime it stores for every file it writes.
+	Tagged int      `json:"tagged_objects,omitempty"`
+	Keys   []string `json:"metadata_keys,omitempty"`
+}
+
+// noteFUSE merges the gcsfuse traces of one listed object into result.
+func noteFUSE(result *Result, obj Object) {
+	marker := strings.HasSuffix(obj.Name, "/") && obj.Size == "0"
+	var keys []string
+	for key := range obj.Metadata {
+		if strings.HasPrefix(key, "gcsfuse_") {
+			keys = append(keys, key)
+		}
+	}
+	if !marker && len(keys) == 0 {
+		return
+	}
+	if result.FUSE == nil {
+		result.FUSE = &FUSEInfo{}
+	}
+	if marker {
+		result.FUSE.DirMarkers++
+	}
+	if len(keys) > 0 {
+		result.FUSE.Tagged++
+		for _, key := range keys {
+			if !slices.Contains(result.FUSE.Keys, key) {
+				result.FUSE.Keys = append(result.FUSE.Keys, key)
+			}
+		}
+		slices.Sort(result.FUSE.Keys)
+	}
+}
+
+// Mounted reports whether the listing proves the bucket was written through
+// gcsfuse, rather than merely holding directory placeholders.
+func (f *FUSEInfo) Mounted() bool {
+	return f.Tagged > 0
+}
+
+// String renders the gcsfuse details compactly for text output.
+func (f *FUSEInfo) String() string {
+	var parts []string
+	if f.Tagged > 0 {
+		parts = append(parts, fmt.Sprintf("%d objects with gcsfuse metadata (%s)", f.Tagged, strings.Join(f.Keys, ", ")))
+	}
+	if f.DirMarkers > 0 {
+		parts = append(parts, fmt.Sprintf("%d directory markers", f.DirMarkers))
+	}
+	state := "possible filesystem mount"
+	if f.Mounted() {
+		state = "mounted with gcsfuse"
+	}
+	return state + " (" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// hookRunner runs a user command for every finding, with the finding passed
+// as JSON on stdin and as GCPENUM_* environment variables. At most a fixed
+// number of hooks run at once, and a failing hook never stops the scan.
+type hookRunner struct {
+	command string
+	sem     chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newHookRunner(command string, concurrency int) *hookRunner {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &hookRunner{command: command, sem: make(chan struct{}, concurrency)}
+}
+
+// Run starts the hook for r, waiting for a free slot first.
+func (h *hookRunner) Run(r Result) {
+	payload, err := json.Marshal(findingRecord{Type: "finding", Result: r})
+	if err != nil {
+		slog.Warn("Could not encode finding for hook", "bucket", r.Bucket, "err", err)
+		return
+	}
+
+	h.sem <- struct{}{}
+	h.wg.Add(1)
+	go func() {
+		defer func() {
+			<-h.sem
+			h.wg.Done()
+		}()
+
+		cmd := shellCommand(h.command)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"GCPENUM_BUCKET="+r.Bucket,
+			"GCPENUM_KEYWORD="+r.Keyword,
+			"GCPENUM_URL="+r.URL,
+			"GCPENUM_CLASSIFICATION="+r.Classification,
+			"GCPENUM_STATUS="+strconv.Itoa(r.StatusCode),
+			"GCPENUM_SEVERITY="+strconv.Itoa(r.Severity),
+			"GCPENUM_OBJECT_COUNT="+strconv.Itoa(r.ObjectCount),
+			"GCPENUM_SCAN_ID="+r.ScanID,
+		)
+		if err := cmd.Run(); err != nil {
+			slog.Warn("Finding hook failed", "bucket", r.Bucket, "err", err)
+		}
+	}()
+}
+
+// Wait blocks until every started hook has finished.
+func (h *hookRunner) Wait() {
+	h.wg.Wait()
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
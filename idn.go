@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// spelledOut transliterates letters that have no decomposition into an
+// ASCII base letter.
+var spelledOut = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d",
+	'þ': "th", 'ł': "l", 'ı': "i", 'ħ': "h", 'ŧ': "t",
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiKeyword transliterates a lowercase keyword for bucket names, which
+// GCS restricts to ASCII: accents are stripped and a few letters are spelled
+// out, so "café-münchen" becomes "cafe-munchen". It reports false when
+// characters without an ASCII spelling remain, as in CJK or Cyrillic names.
+func asciiKeyword(keyword string) (string, bool) {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(keyword) {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+		case spelledOut[r] != "":
+			b.WriteString(spelledOut[r])
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// idnHost returns the ASCII form of a hostname, punycode-encoding labels
+// outside ASCII. ASCII hosts are returned as they are.
+func idnHost(host string) (string, error) {
+	if isASCII(host) {
+		return host, nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+// idnDomains returns the punycode forms of a non-ASCII keyword with each TLD
+// appended: the names of domain-named buckets for its internationalized
+// domains, e.g. "xn--mnchen-3ya.de" for "münchen" and "de".
+func idnDomains(keyword string, tlds []string) []string {
+	var names []string
+	for _, tld := range tlds {
+		if host, err := idnHost(keyword + "." + tld); err == nil {
+			names = append(names, host)
+		}
+	}
+	return names
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestASCIIKeyword(t *testing.T) {
+	tests := []struct {
+		keyword, want string
+		ok            bool
+	}{
+		{"acme-corp", "acme-corp", true},
+		{"café-münchen", "cafe-munchen", true},
+		// Precomposed and decomposed accents transliterate alike.
+		{"cafe\u0301", "cafe", true},
+		{"straße", "strasse", true},
+		{"æøå", "aeoa", true},
+		{"łódź", "lodz", true},
+		{"þorsmörk", "thorsmork", true},
+		{"東京", "", false},
+		{"москва", "", false},
+		// One letter without a spelling rejects the whole keyword.
+		{"acme-東京", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := asciiKeyword(tt.keyword)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("asciiKeyword(%q) = %q, %v, want %q, %v", tt.keyword, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIDNDomains(t *testing.T) {
+	tests := []struct {
+		keyword string
+		tlds    []string
+		want    []string
+	}{
+		{"münchen", []string{"de"}, []string{"xn--mnchen-3ya.de"}},
+		{"café", []string{"com", "fr"}, []string{"xn--caf-dma.com", "xn--caf-dma.fr"}},
+		{"東京", []string{"jp"}, []string{"xn--1lqs71d.jp"}},
+		{"москва", []string{"рф"}, []string{"xn--80adxhks.xn--p1ai"}},
+	}
+	for _, tt := range tests {
+		if got := idnDomains(tt.keyword, tt.tlds); !slices.Equal(got, tt.want) {
+			t.Errorf("idnDomains(%q, %v) = %v, want %v", tt.keyword, tt.tlds, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCandidatesUnicodeKeyword(t *testing.T) {
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("dev\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &genOptions{wordlistPath: wordlist, tlds: []string{"de"}}
+
+	// The punycode domain keeps the keyword as written, everything else
+	// uses its transliteration.
+	got := candidateNames([]keywordSpec{{Keyword: "München"}}, opts)
+	want := []string{"xn--mnchen-3ya.de", "munchen", "munchen.de", "munchen-dev", "dev-munchen", "munchen_dev", "dev_munchen", "munchendev", "devmunchen"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Without an ASCII spelling only the punycode domain is scanned.
+	quietLogs(t)
+	got = candidateNames([]keywordSpec{{Keyword: "東京"}}, &genOptions{wordlistPath: wordlist, tlds: []string{"jp"}})
+	if want := []string{"xn--1lqs71d.jp"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
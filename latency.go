@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets is the number of histogram buckets, four per doubling
+// from 1µs, which reaches past any request timeout.
+const latencyBuckets = 112
+
+// latencyHistogram counts durations in logarithmic buckets. Updates are
+// lock-free, and a percentile is exact to within one bucket, about 19%.
+type latencyHistogram struct {
+	buckets [latencyBuckets]atomic.Int64
+	count   atomic.Int64
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	i := 0
+	if us := d.Microseconds(); us > 1 {
+		i = min(int(math.Log2(float64(us))*4), latencyBuckets-1)
+	}
+	h.buckets[i].Add(1)
+	h.count.Add(1)
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile, or 0 when nothing was recorded.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	total := h.count.Load()
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(total)))
+	var seen int64
+	for i := range h.buckets {
+		if seen += h.buckets[i].Load(); seen >= rank {
+			return time.Duration(math.Exp2(float64(i+1)/4) * float64(time.Microsecond))
+		}
+	}
+	return 0
+}
+
+func (h *latencyHistogram) percentiles() Percentiles {
+	ms := func(p float64) float64 {
+		return math.Round(float64(h.percentile(p))/float64(time.Millisecond)*100) / 100
+	}
+	return Percentiles{P50: ms(50), P90: ms(90), P99: ms(99)}
+}
+
+// latencyStats tracks, for -latency-report, the latency of every request
+// until its response headers arrived, and its time to first byte: the wait
+// after the request was written, which leaves out connection setup.
+type latencyStats struct {
+	latency latencyHistogram
+	ttfb    latencyHistogram
+}
+
+func (l *latencyStats) report() *LatencyReport {
+	return &LatencyReport{
+		Requests: l.latency.count.Load(),
+		Latency:  l.latency.percentiles(),
+		TTFB:     l.ttfb.percentiles(),
+	}
+}
+
+// LatencyReport is the -latency-report section of the summary, in
+// milliseconds. Requests that failed without a response are not included.
+type LatencyReport struct {
+	Requests int64       `json:"requests"`
+	Latency  Percentiles `json:"latency"`
+	TTFB     Percentiles `json:"ttfb"`
+}
+
+type Percentiles struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+func (p Percentiles) String() string {
+	return fmt.Sprintf("p50 %.1fms, p90 %.1fms, p99 %.1fms", p.P50, p.P90, p.P99)
+}
@@ -0,0 +1,898 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestScanner points the GCS hosts at an httptest server running
+// handler and returns a scanner with the client the scan itself would use.
+func newTestScanner(t *testing.T, handler http.Handler, opts clientOptions) *scanner {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	oldStorage, oldJSON := storageHost, jsonAPIHost
+	storageHost, jsonAPIHost = srv.URL, srv.URL
+	t.Cleanup(func() { storageHost, jsonAPIHost = oldStorage, oldJSON })
+
+	opts.Workers = max(opts.Workers, 1)
+	client, err := newHTTPClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &scanner{
+		client:    client,
+		listQueue: make(chan listJob, 16),
+		probeSem:  make(chan struct{}, 1),
+	}
+}
+
+// checkOne probes a single bucket and returns the results reported for it.
+func checkOne(s *scanner, name string) []Result {
+	output := make(chan Result, 16)
+	s.checkBucket(candidate{Name: name, Keyword: name}, output)
+	close(output)
+	var results []Result
+	for r := range output {
+		results = append(results, r)
+	}
+	return results
+}
+
+// gcsError writes a JSON API error response with the given reason.
+func gcsError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":%q,"errors":[{"reason":%q,"message":%q}]}}`, code, message, reason, message)
+}
+
+func TestCheckBucketFirstResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/storage/v1/b/moved/o", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/landing", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/storage/v1/b/login/o", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/landing?next=login", http.StatusFound)
+	})
+	mux.HandleFunc("/storage/v1/b/blocked/o", func(w http.ResponseWriter, r *http.Request) {
+		gcsError(w, http.StatusUnavailableForLegalReasons, "unavailableForLegalReasons", "Unavailable for legal reasons")
+	})
+	// A target that looks like a listing would make the bucket LISTABLE
+	// if the probe followed the redirect.
+	mux.HandleFunc("/landing", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items":[{"name":"index.html"}]}`)
+	})
+
+	tests := []struct {
+		bucket    string
+		statusMap map[int]string
+		class     string
+		status    int
+		redirect  string
+	}{
+		{bucket: "moved", class: ClassRedirect, status: 301, redirect: "/landing"},
+		{bucket: "login", class: ClassRedirect, status: 302, redirect: "/landing?next=login"},
+		{bucket: "blocked", class: ClassUnknown, status: 451},
+		{bucket: "blocked", statusMap: map[int]string{451: "BLOCKED"}, class: "BLOCKED", status: 451},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.bucket, tt.status), func(t *testing.T) {
+			s := newTestScanner(t, mux, clientOptions{})
+			s.statusMap = tt.statusMap
+			results := checkOne(s, tt.bucket)
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1: %+v", len(results), results)
+			}
+			r := results[0]
+			if r.Classification != tt.class || r.StatusCode != tt.status {
+				t.Errorf("got %s (status %d), want %s (status %d)", r.Classification, r.StatusCode, tt.class, tt.status)
+			}
+			if tt.redirect != "" && r.Redirect != jsonAPIHost+tt.redirect {
+				t.Errorf("redirect = %q, want %q", r.Redirect, jsonAPIHost+tt.redirect)
+			}
+			if r.ObjectCount != 0 {
+				t.Errorf("listed %d objects from the redirect target", r.ObjectCount)
+			}
+		})
+	}
+}
+
+func TestRedirectsFollowedOutsideProbes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, noFollow := range []bool{false, true} {
+		s := newTestScanner(t, mux, clientOptions{NoFollowRedirects: noFollow})
+		resp, err := s.get(storageHost + "/old")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		want := http.StatusOK
+		if noFollow {
+			want = http.StatusFound
+		}
+		if resp.StatusCode != want {
+			t.Errorf("NoFollowRedirects=%v: status %d, want %d", noFollow, resp.StatusCode, want)
+		}
+	}
+}
+
+// writeWordlist writes a wordlist of n distinct synthetic words.
+func writeWordlist(tb testing.TB, n int) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "wordlist.txt")
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for i := range n {
+		fmt.Fprintf(w, "word%07d\n", i)
+	}
+	if err := w.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	f.Close()
+	return path
+}
+
+// quietLogs discards log output for the rest of a test or benchmark.
+func quietLogs(tb testing.TB) {
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tb.Cleanup(func() { slog.SetDefault(old) })
+}
+
+// heapPeak samples the live heap every sampleEvery calls of its returned
+// func and reports the highest sample above the starting heap in MB.
+type heapPeak struct {
+	base, peak uint64
+	calls      int
+}
+
+func newHeapPeak() *heapPeak {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return &heapPeak{base: m.HeapAlloc}
+}
+
+func (h *heapPeak) sample() {
+	if h.calls++; h.calls%50000 != 0 {
+		return
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	if m.HeapAlloc > h.base && m.HeapAlloc-h.base > h.peak {
+		h.peak = m.HeapAlloc - h.base
+	}
+}
+
+func (h *heapPeak) report(b *testing.B) {
+	b.ReportMetric(float64(h.peak)/(1<<20), "peak-heap-MB")
+	b.ReportMetric(float64(h.calls), "candidates")
+}
+
+// BenchmarkCandidateStream compares the heap of streaming about 1.2M candidates
+// to the workers with collecting them first, as the scan did before
+// generation was streamed. De-duplication uses a small bloom filter in both,
+// so the difference is the candidate list alone.
+func BenchmarkCandidateStream(b *testing.B) {
+	quietLogs(b)
+	opts := &genOptions{wordlistPath: writeWordlist(b, 200000), noTLDs: true, bloomThreshold: 1000, bloomSize: 1 << 20}
+	keywords := []keywordSpec{{Keyword: "acme"}}
+	lists := &nameLists{}
+	b.Run("streamed", func(b *testing.B) {
+		for range b.N {
+			peak := newHeapPeak()
+			for range generateCandidates(keywords, opts, lists) {
+				peak.sample()
+			}
+			peak.report(b)
+		}
+	})
+	b.Run("collected", func(b *testing.B) {
+		for range b.N {
+			peak := newHeapPeak()
+			var all []candidate
+			for c := range generateCandidates(keywords, opts, lists) {
+				all = append(all, c)
+				peak.sample()
+			}
+			peak.report(b)
+			runtime.KeepAlive(all)
+		}
+	})
+}
+
+func TestRetryWithUserProject(t *testing.T) {
+	const requesterPays = "Bucket is a requester pays bucket but no user project provided."
+	// GCS answers a requester-pays listing without userProject with a 400,
+	// and one billed to a project the caller may not use with a 403.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("userProject") == "":
+			gcsError(w, http.StatusBadRequest, "required", requesterPays)
+		case r.Header.Get("Authorization") != "Bearer good-token":
+			gcsError(w, http.StatusForbidden, "forbidden", "Caller does not have serviceusage.services.use access to the Google Cloud project.")
+		default:
+			fmt.Fprint(w, `{"items":[{"name":"invoice.pdf"}]}`)
+		}
+	})
+
+	tests := []struct {
+		token string
+		class string
+		error string
+	}{
+		{token: "good-token", class: ClassListable},
+		{token: "other-token", class: ClassRequesterPays, error: "Retrying billed with user project my-project failed with status 403 - Caller does not have serviceusage.services.use access to the Google Cloud project."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			s := newTestScanner(t, handler, clientOptions{})
+			s.userProject, s.userToken = "my-project", tt.token
+			results := checkOne(s, "billed")
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			r := results[0]
+			if r.Classification != tt.class || !r.RequesterPays {
+				t.Errorf("got %s (requester pays %v), want %s", r.Classification, r.RequesterPays, tt.class)
+			}
+			if r.Error != tt.error {
+				t.Errorf("error = %q, want %q", r.Error, tt.error)
+			}
+		})
+	}
+}
+
+func TestFirstHitPerKeyword(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gcsError(w, http.StatusForbidden, "forbidden", "Anonymous caller does not have storage.objects.list access")
+	})
+	s := newTestScanner(t, handler, clientOptions{})
+	s.firstHit = true
+
+	// Every bucket exists, so each generated candidate after a keyword's
+	// first one is skipped, while exact names never are and do not stop
+	// their keyword either.
+	candidates := []candidate{
+		{Name: "acme-site", Keyword: "acme.com", Explicit: true},
+		{Name: "acme-allow", Allowlisted: true},
+		{Name: "acme.com", Keyword: "acme.com"},
+		{Name: "acme.com-dev", Keyword: "acme.com"},
+		{Name: "acme-names", Keyword: "acme.com", Explicit: true},
+		{Name: "other-allow", Allowlisted: true},
+	}
+	output := make(chan Result, len(candidates))
+	for _, c := range candidates {
+		s.scan(c, output)
+	}
+	close(output)
+	var scanned []string
+	for r := range output {
+		scanned = append(scanned, r.Bucket)
+	}
+	want := []string{"acme-site", "acme-allow", "acme.com", "acme-names", "other-allow"}
+	if fmt.Sprint(scanned) != fmt.Sprint(want) {
+		t.Errorf("scanned %v, want %v", scanned, want)
+	}
+}
+
+func TestCanaryLeftOutOfRequestCount(t *testing.T) {
+	s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gcsError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+	}), clientOptions{})
+	requests, canaries := atomic.LoadInt64(&requestCount), atomic.LoadInt64(&canaryRequests)
+	if _, err := s.probeCanary("gcpenum-canary-test"); err != nil {
+		t.Fatal(err)
+	}
+	checkOne(s, "acme")
+	if got := atomic.LoadInt64(&requestCount) - requests; got != 1 {
+		t.Errorf("request count grew by %d, want 1 for the probe alone", got)
+	}
+	if got := atomic.LoadInt64(&canaryRequests) - canaries; got != 1 {
+		t.Errorf("canary count grew by %d, want 1", got)
+	}
+}
+
+func TestObjectRegexDoesNotRaiseSeverity(t *testing.T) {
+	listings := map[string]string{
+		"reports": `{"items":[{"name":"q1.csv"},{"name":"logo.png"}]}`,
+		"secrets": `{"items":[{"name":"q1.csv"},{"name":".env"}]}`,
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for bucket, listing := range listings {
+			if r.URL.Path == "/storage/v1/b/"+bucket+"/o" {
+				fmt.Fprint(w, listing)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	tests := []struct {
+		bucket    string
+		sensitive []string
+		matched   []string
+		severity  int
+	}{
+		{bucket: "reports", matched: []string{"q1.csv"}, severity: SeverityMedium},
+		{bucket: "secrets", sensitive: []string{".env"}, matched: []string{"q1.csv"}, severity: SeverityHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bucket, func(t *testing.T) {
+			s := newTestScanner(t, handler, clientOptions{})
+			s.objectRE = regexp.MustCompile(`\.csv$`)
+			r := checkOne(s, tt.bucket)[0]
+			if !slices.Equal(r.Sensitive, tt.sensitive) || !slices.Equal(r.Matched, tt.matched) {
+				t.Errorf("sensitive %v, matched %v; want %v, %v", r.Sensitive, r.Matched, tt.sensitive, tt.matched)
+			}
+			if r.Severity != tt.severity {
+				t.Errorf("severity %d, want %d", r.Severity, tt.severity)
+			}
+		})
+	}
+}
+
+func TestBucketMetadataOptIn(t *testing.T) {
+	for _, metadata := range []bool{false, true} {
+		var metadataRequests int
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/storage/v1/b/public":
+				metadataRequests++
+				fmt.Fprint(w, `{"name":"public","location":"EU","storageClass":"NEARLINE"}`)
+			case "/storage/v1/b/public/o":
+				fmt.Fprint(w, `{"items":[{"name":"a.txt"}]}`)
+			default:
+				http.NotFound(w, r)
+			}
+		})
+		s := newTestScanner(t, handler, clientOptions{})
+		s.metadata = metadata
+		r := checkOne(s, "public")[0]
+		want, location := 0, ""
+		if metadata {
+			want, location = 1, "EU"
+		}
+		if metadataRequests != want || r.Location != location {
+			t.Errorf("metadata=%v: %d metadata requests, location %q; want %d, %q", metadata, metadataRequests, r.Location, want, location)
+		}
+	}
+}
+
+func TestCompareWithXML(t *testing.T) {
+	tests := []struct {
+		jsonStatus, xmlStatus int
+		mismatch              string
+		severity              int
+	}{
+		{jsonStatus: 200, xmlStatus: 403, mismatch: "XML endpoint says exists, JSON API says listable", severity: SeverityMedium},
+		{jsonStatus: 404, xmlStatus: 403, mismatch: "XML endpoint says exists, JSON API says missing", severity: SeverityLow},
+		{jsonStatus: 401, xmlStatus: 200, mismatch: "XML endpoint says listable, JSON API says exists", severity: SeverityMedium},
+		{jsonStatus: 403, xmlStatus: 401},
+		{jsonStatus: 404, xmlStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%d", tt.jsonStatus, tt.xmlStatus), func(t *testing.T) {
+			s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/bucket" {
+					t.Errorf("unexpected request for %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.xmlStatus)
+			}), clientOptions{})
+			output := make(chan Result, 1)
+			s.compareWithXML(candidate{Name: "bucket", Keyword: "bucket"}, tt.jsonStatus, output)
+			close(output)
+			r, found := <-output
+			if tt.mismatch == "" {
+				if found {
+					t.Errorf("reported %s for agreeing endpoints", r.Classification)
+				}
+				return
+			}
+			if !found || r.Classification != ClassEndpointMismatch {
+				t.Fatalf("got %+v, want an %s finding", r, ClassEndpointMismatch)
+			}
+			if r.Error != tt.mismatch || r.Severity != tt.severity || r.StatusCode != tt.jsonStatus || r.XMLStatus != tt.xmlStatus {
+				t.Errorf("got %q (severity %d, statuses %d/%d), want %q (severity %d)", r.Error, r.Severity, r.StatusCode, r.XMLStatus, tt.mismatch, tt.severity)
+			}
+		})
+	}
+}
+
+func TestListPageTimeoutShrinksAndRollsBack(t *testing.T) {
+	quietLogs(t)
+	var attempts []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := r.URL.Query().Get("maxResults")
+		attempts = append(attempts, size)
+		if size == "1000" {
+			// Send part of the page, then stall past the listing timeout.
+			fmt.Fprint(w, `{"items":[{"name":"b.txt","md5Hash":"Yg=="},{"name":"c.txt"},`)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, `{"items":[{"name":"b.txt","md5Hash":"Yg=="},{"name":"c.txt"},{"name":"d.txt"}]}`)
+	})
+	s := newTestScanner(t, handler, clientOptions{})
+	s.pageSize, s.autoPageSize = 1000, true
+	s.timeouts[classListing] = 200 * time.Millisecond
+	s.objectHashes = newObjectIndex()
+
+	first := Result{Bucket: "deep", Classification: ClassListable, ObjectCount: 1, Objects: []string{"a.txt"}}
+	s.listQueue <- listJob{result: first, params: s.listParams(), pageToken: "p2"}
+	close(s.listQueue)
+	output := make(chan Result, 1)
+	s.listWorker(output)
+	r := <-output
+
+	if !slices.Equal(attempts, []string{"1000", "500"}) {
+		t.Errorf("page sizes requested %v, want [1000 500]", attempts)
+	}
+	if want := []string{"a.txt", "b.txt", "c.txt", "d.txt"}; r.ObjectCount != 4 || !slices.Equal(r.Objects, want) {
+		t.Errorf("listed %d objects %v, want 4 %v", r.ObjectCount, r.Objects, want)
+	}
+	if len(r.Duplicates) != 0 || r.Error != "" {
+		t.Errorf("duplicates %v, error %q after the retry", r.Duplicates, r.Error)
+	}
+}
+
+// candidateNames drains generateCandidates into a list of names.
+func candidateNames(keywords []keywordSpec, opts *genOptions) []string {
+	var names []string
+	for c := range generateCandidates(keywords, opts, &nameLists{}) {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestGenerateCandidatesShapes(t *testing.T) {
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("dev\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bare := []string{"acme"}
+	tlds := []string{"acme.com", "acme.net"}
+	perms := []string{"acme-dev", "dev-acme", "acme_dev", "dev_acme", "acmedev", "devacme"}
+
+	// Every combination of the -include-keyword-as-is, -include-tlds and
+	// -include-permutations toggles.
+	for mask := range 8 {
+		noBare, noTLDs, noPermutations := mask&1 != 0, mask&2 != 0, mask&4 != 0
+		var want []string
+		if !noBare {
+			want = append(want, bare...)
+		}
+		if !noTLDs {
+			want = append(want, tlds...)
+		}
+		if !noPermutations {
+			want = append(want, perms...)
+		}
+		name := fmt.Sprintf("bare=%v/tlds=%v/permutations=%v", !noBare, !noTLDs, !noPermutations)
+		t.Run(name, func(t *testing.T) {
+			opts := &genOptions{wordlistPath: wordlist, tlds: []string{"com", "net"}, noBare: noBare, noTLDs: noTLDs, noPermutations: noPermutations}
+			got := candidateNames([]keywordSpec{{Keyword: "acme"}}, opts)
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateCandidatesLowercase(t *testing.T) {
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("dev\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &genOptions{wordlistPath: wordlist, tlds: []string{"com"}, expand: true, typos: true}
+	var n int
+	for c := range generateCandidates([]keywordSpec{{Keyword: "AcmeCorp"}}, opts, &nameLists{}) {
+		n++
+		if c.Name != strings.ToLower(c.Name) {
+			t.Errorf("generated %q, which is not lowercase", c.Name)
+		}
+		if c.Keyword != "AcmeCorp" {
+			t.Errorf("%q attributed to keyword %q, want AcmeCorp as given", c.Name, c.Keyword)
+		}
+	}
+	if n == 0 {
+		t.Fatal("no candidates generated")
+	}
+	if got := candidateNames([]keywordSpec{{Keyword: "AcmeCorp"}}, &genOptions{wordlistPath: wordlist, noTLDs: true, noPermutations: true}); !slices.Equal(got, []string{"acmecorp"}) {
+		t.Errorf("bare form %v, want [acmecorp]", got)
+	}
+}
+
+func TestReasonClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		class   string // "" when the bucket is not reported
+		message string
+	}{
+		{"notFound", 403, `{"error":{"code":403,"message":"The specified bucket does not exist.","errors":[{"domain":"global","reason":"notFound","message":"The specified bucket does not exist."}]}}`, "", ""},
+		{"forbidden", 403, `{"error":{"code":403,"message":"Anonymous caller does not have storage.objects.list access to the Google Cloud Storage bucket.","errors":[{"domain":"global","reason":"forbidden","message":"Anonymous caller does not have storage.objects.list access to the Google Cloud Storage bucket."}]}}`, ClassExists, ""},
+		{"accessDenied", 403, `{"error":{"code":403,"message":"Access denied.","errors":[{"domain":"global","reason":"accessDenied","message":"Access denied."}]}}`, ClassExists, ""},
+		{"insufficientPermissions", 403, `{"error":{"code":403,"message":"Insufficient Permission","errors":[{"domain":"global","reason":"insufficientPermissions","message":"Insufficient Permission"}]}}`, ClassExists, ""},
+		{"accessNotConfigured", 403, `{"error":{"code":403,"message":"Cloud Storage JSON API has not been used in project 123 before or it is disabled.","errors":[{"domain":"usageLimits","reason":"accessNotConfigured","message":"Access Not Configured."}]}}`, ClassUnknown, "Cloud Storage JSON API has not been used in project 123 before or it is disabled."},
+		{"userProjectAccountProblem", 403, `{"error":{"code":403,"message":"The project to be billed is associated with a closed billing account.","errors":[{"domain":"global","reason":"userProjectAccountProblem","message":"The project to be billed is associated with a closed billing account."}]}}`, ClassUnknown, "The project to be billed is associated with a closed billing account."},
+		{"billingNotEnabled", 403, `{"error":{"code":403,"message":"The billing account for the owning project is disabled in state closed","errors":[{"domain":"global","reason":"billingNotEnabled","message":"The billing account for the owning project is disabled in state closed"}]}}`, ClassUnknown, "The billing account for the owning project is disabled in state closed"},
+		{"userProjectMissing", 400, `{"error":{"code":400,"message":"Bucket is a requester pays bucket but no user project provided.","errors":[{"domain":"global","reason":"userProjectMissing","message":"Bucket is a requester pays bucket but no user project provided."}]}}`, ClassRequesterPays, ""},
+		{"requiredRequesterPays", 400, `{"error":{"code":400,"message":"Bucket is a requester pays bucket but no user project provided.","errors":[{"domain":"global","reason":"required","message":"Bucket is a requester pays bucket but no user project provided."}]}}`, ClassRequesterPays, ""},
+		{"invalid", 400, `{"error":{"code":400,"message":"Invalid bucket name: 'Acme'","errors":[{"domain":"global","reason":"invalid","message":"Invalid bucket name: 'Acme'"}]}}`, ClassInvalidName, "Invalid bucket name: 'Acme'"},
+		{"unknownReason", 403, `{"error":{"code":403,"message":"Something new.","errors":[{"domain":"global","reason":"somethingNew","message":"Something new."}]}}`, ClassExists, ""},
+		{"noBody", 403, ``, ClassExists, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/storage/v1/b/bucket/o" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}), clientOptions{})
+			results := checkOne(s, "bucket")
+			if tt.class == "" {
+				if len(results) != 0 {
+					t.Fatalf("reported %s for a missing bucket", results[0].Classification)
+				}
+				return
+			}
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			r := results[0]
+			if r.Classification != tt.class || r.StatusCode != tt.status || r.Error != tt.message {
+				t.Errorf("got %s (status %d, error %q), want %s (status %d, error %q)", r.Classification, r.StatusCode, r.Error, tt.class, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestLoadKeywordDirDedup(t *testing.T) {
+	quietLogs(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "Acme\nfoo\n", "b.txt": "acme\nfoo\nAcme\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, spec := range loadKeywordDir(dir, false) {
+		got = append(got, spec.Keyword)
+	}
+	if want := []string{"Acme", "foo", "acme"}; !slices.Equal(got, want) {
+		t.Errorf("keywords %v, want %v", got, want)
+	}
+}
+
+// BenchmarkTransport compares the probe throughput of HTTP/1.1 and HTTP/2
+// against a local TLS server with 50 workers, reporting requests per second
+// and the connections each protocol opened.
+func BenchmarkTransport(b *testing.B) {
+	for _, http1 := range []bool{true, false} {
+		name := "http2"
+		if http1 {
+			name = "http1"
+		}
+		b.Run(name, func(b *testing.B) {
+			var conns atomic.Int64
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gcsError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+			}))
+			srv.EnableHTTP2 = true
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			srv.StartTLS()
+			defer srv.Close()
+
+			client, err := newHTTPClient(clientOptions{Workers: 50, HTTP1: http1})
+			if err != nil {
+				b.Fatal(err)
+			}
+			transport := client.Transport.(*http.Transport)
+			transport.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+			// Open the first connection up front, as concurrent dials to a
+			// host without one each get their own.
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				b.Fatal(err)
+			}
+			resp.Body.Close()
+
+			b.SetParallelism(max(50/runtime.GOMAXPROCS(0), 1))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					resp, err := client.Get(srv.URL + "/storage/v1/b/bucket/o")
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					if (resp.ProtoMajor == 2) == http1 {
+						b.Errorf("got %s", resp.Proto)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+			b.ReportMetric(float64(conns.Load()), "conns")
+		})
+	}
+}
+
+func TestRemoveDuplicatesFallsBackToBloom(t *testing.T) {
+	quietLogs(t)
+	input := make(chan candidate)
+	go func() {
+		defer close(input)
+		for _, name := range []string{"acme", "acme-dev", "acme-prod", "acme", "acme-prod", "acme-dev"} {
+			input <- candidate{Name: name}
+		}
+	}()
+	// The set is folded into the filter at the second name, so names from
+	// before and after the switch are both recognised.
+	var got []string
+	for c := range removeDuplicates(input, 2, 1<<10) {
+		got = append(got, c.Name)
+	}
+	if want := []string{"acme", "acme-dev", "acme-prod"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// BenchmarkCandidateDedup measures what candidate memory grows with once
+// generation is streamed: the exact de-duplication set, against a
+// -bloom-threshold switch to a 4 MB bloom filter.
+func BenchmarkCandidateDedup(b *testing.B) {
+	quietLogs(b)
+	wordlist := writeWordlist(b, 200000)
+	keywords := []keywordSpec{{Keyword: "acme"}}
+	for _, bench := range []struct {
+		name      string
+		threshold int
+	}{{"exact", 0}, {"bloom", 10000}} {
+		b.Run(bench.name, func(b *testing.B) {
+			opts := &genOptions{wordlistPath: wordlist, noTLDs: true, bloomThreshold: bench.threshold, bloomSize: 4 << 20}
+			for range b.N {
+				peak := newHeapPeak()
+				for range generateCandidates(keywords, opts, &nameLists{}) {
+					peak.sample()
+				}
+				peak.report(b)
+			}
+		})
+	}
+}
+
+func TestObjectsPreviewStopsListing(t *testing.T) {
+	tests := []struct {
+		preview, requests, count int
+		partial                  bool
+	}{
+		{preview: 2, requests: 1, count: 2, partial: true},
+		{preview: 3, requests: 2, count: 4},
+		{preview: 0, requests: 2, count: 4},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.preview), func(t *testing.T) {
+			var requests atomic.Int64
+			s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/storage/v1/b/deep/o" {
+					http.NotFound(w, r)
+					return
+				}
+				requests.Add(1)
+				if r.URL.Query().Get("pageToken") == "" {
+					fmt.Fprint(w, `{"items":[{"name":"a"},{"name":"b"}],"nextPageToken":"p2"}`)
+				} else {
+					fmt.Fprint(w, `{"items":[{"name":"c"},{"name":"d"}]}`)
+				}
+			}), clientOptions{})
+			s.objectsPreview = tt.preview
+
+			output := make(chan Result, 1)
+			s.checkBucket(candidate{Name: "deep"}, output)
+			close(s.listQueue)
+			s.listWorker(output)
+			r := <-output
+			if got := int(requests.Load()); got != tt.requests || r.ObjectCount != tt.count || r.PartialCount != tt.partial {
+				t.Errorf("%d requests, %d objects (partial %v); want %d, %d (partial %v)", got, r.ObjectCount, r.PartialCount, tt.requests, tt.count, tt.partial)
+			}
+		})
+	}
+}
+
+func TestListQueueBackPressure(t *testing.T) {
+	const queueSize, buckets = 2, 8
+	s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprint(w, `{"items":[{"name":"a"}],"nextPageToken":"p2"}`)
+		} else {
+			fmt.Fprint(w, `{"items":[{"name":"b"}]}`)
+		}
+	}), clientOptions{})
+	s.listQueue = make(chan listJob, queueSize)
+
+	// Every bucket has a second page, and no listing worker runs yet, so
+	// discovery must stall once the queue is full.
+	output := make(chan Result, buckets)
+	var probed atomic.Int64
+	var wg sync.WaitGroup
+	for i := range buckets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.checkBucket(candidate{Name: fmt.Sprintf("bucket-%d", i)}, output)
+			probed.Add(1)
+		}()
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n, depth := probed.Load(), len(s.listQueue); n > queueSize || depth > queueSize {
+		t.Errorf("%d probes finished with %d jobs queued, want at most %d", n, depth, queueSize)
+	}
+
+	var maxDepth atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		s.listWorker(output)
+		close(done)
+	}()
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if depth := int64(len(s.listQueue)); depth > maxDepth.Load() {
+				maxDepth.Store(depth)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+	wg.Wait()
+	close(s.listQueue)
+	<-done
+
+	if got := len(output); got != buckets {
+		t.Errorf("%d buckets reported, want %d", got, buckets)
+	}
+	if d := maxDepth.Load(); d > queueSize {
+		t.Errorf("queue depth reached %d, want at most %d", d, queueSize)
+	}
+}
+
+func TestAuthRequiredIsAnExistingBucket(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/storage/v1/b/gated/o":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="https://accounts.google.com/"`)
+			gcsError(w, http.StatusUnauthorized, "required", "Anonymous caller does not have storage.objects.list access")
+		case r.URL.Path == "/gated/.git/config":
+			fmt.Fprint(w, "[core]")
+		case r.URL.Path == "/gated" && r.URL.Query().Get("list-type") == "2":
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>dump.sql</Key></Contents></ListBucketResult>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	s := newTestScanner(t, handler, clientOptions{})
+	s.probePaths = []string{".git/config", "backup.sql"}
+	r := checkOne(s, "gated")[0]
+	if r.Classification != ClassAuthRequired || !slices.Equal(r.ExposedPaths, []string{".git/config"}) {
+		t.Errorf("got %s with exposed paths %v, want %s with [.git/config]", r.Classification, r.ExposedPaths, ClassAuthRequired)
+	}
+
+	s = newTestScanner(t, handler, clientOptions{})
+	s.xmlFallback = true
+	r = checkOne(s, "gated")[0]
+	if r.Classification != ClassListable || r.ListedVia != "xml" || r.ObjectCount != 1 {
+		t.Errorf("with -xml-fallback got %s via %q with %d objects, want LISTABLE via xml", r.Classification, r.ListedVia, r.ObjectCount)
+	}
+
+	if got := accessTransition(ClassListable, ClassAuthRequired); got != TransitionNewlyPrivate {
+		t.Errorf("LISTABLE -> AUTH_REQUIRED transition %q, want %s", got, TransitionNewlyPrivate)
+	}
+	if got := accessTransition(ClassAuthRequired, ClassListable); got != TransitionNewlyPublic {
+		t.Errorf("AUTH_REQUIRED -> LISTABLE transition %q, want %s", got, TransitionNewlyPublic)
+	}
+}
+
+// resetAbort restores the process-wide abort state after a test aborted.
+func resetAbort(t *testing.T) {
+	t.Cleanup(func() {
+		consecutiveErrors, totalErrors, consecutiveProxyAuth = 0, 0, 0
+		abortOnce, abortReason, scanAborted = sync.Once{}, "", make(chan struct{})
+	})
+}
+
+func TestProxyAuthAbortsOnlyWhenSystemic(t *testing.T) {
+	quietLogs(t)
+	resetAbort(t)
+	var refuse atomic.Bool
+	s := newTestScanner(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if refuse.Load() {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		gcsError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+	}), clientOptions{})
+
+	// Isolated 407s between answered probes fail only their own probe.
+	for i := range 3 * proxyAuthLimit {
+		refuse.Store(i%2 == 1)
+		results := checkOne(s, fmt.Sprintf("bucket-%d", i))
+		if refuse.Load() && (len(results) != 1 || results[0].Classification != ClassError) {
+			t.Fatalf("407 probe reported %+v, want an ERROR finding", results)
+		}
+	}
+	if aborted() {
+		t.Fatal("scan aborted on isolated 407s")
+	}
+
+	refuse.Store(true)
+	for i := range proxyAuthLimit {
+		if aborted() {
+			t.Fatalf("scan aborted after %d consecutive 407s, want %d", i, proxyAuthLimit)
+		}
+		checkOne(s, fmt.Sprintf("refused-%d", i))
+	}
+	if !aborted() || abortReason != fmt.Sprintf("%d consecutive proxy authentication errors (407)", proxyAuthLimit) {
+		t.Errorf("aborted %v with reason %q after %d consecutive 407s", aborted(), abortReason, proxyAuthLimit)
+	}
+}
+
+func TestRefusedProxyTunnelIsProxyAuthError(t *testing.T) {
+	quietLogs(t)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer proxy.Close()
+	client, err := newHTTPClient(clientOptions{Proxy: proxy.URL, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Get("https://bucket.example.invalid/")
+	if err == nil || !isProxyAuthError(err) {
+		t.Errorf("refused CONNECT failed with %v, want a proxy authentication error", err)
+	}
+}
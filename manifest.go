@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+)
+
+// version is reported in the scan manifest. Release builds set it with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+// Manifest describes a whole run for -manifest: how the scan was invoked and
+// what it found, without the findings themselves.
+type Manifest struct {
+	Tool       string            `json:"tool"`
+	Version    string            `json:"version"`
+	Flags      map[string]string `json:"flags"`
+	Keywords   int               `json:"keywords"`
+	Candidates int64             `json:"candidates"`
+	Skipped    int64             `json:"skipped,omitempty"`
+	Requests   int64             `json:"requests"`
+	StartTime  time.Time         `json:"start_time"`
+	EndTime    time.Time         `json:"end_time"`
+	Counts     map[string]int    `json:"counts"`
+
+	CandidateHash string `json:"candidate_hash"`
+	ScanID        string `json:"scan_id"`
+}
+
+// newManifest captures the effective value of every flag, so the profile
+// and defaults in force are recorded along with what was set explicitly.
+func newManifest(keywords int, start time.Time, summary Summary) Manifest {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	return Manifest{
+		Tool:       "gcpenum",
+		Version:    version,
+		Flags:      flags,
+		Keywords:   keywords,
+		Candidates: summary.Scanned,
+		Skipped:    summary.Skipped,
+		Requests:   summary.Requests,
+		StartTime:  start.UTC(),
+		EndTime:    time.Now().UTC(),
+		Counts:     summary.Counts,
+
+		CandidateHash: summary.CandidateHash,
+		ScanID:        summary.ScanID,
+	}
+}
+
+func writeManifest(path string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats selectable with -format.
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+	FormatSARIF  = "sarif"
+)
+
+// csvHeader names the columns of csv output.
+var csvHeader = []string{"bucket", "keyword", "classification", "http_status", "severity", "object_count", "url", "error", "scan_id"}
+
+func validFormat(format string) bool {
+	switch format {
+	case FormatText, FormatJSON, FormatNDJSON, FormatCSV, FormatSARIF:
+		return true
+	}
+	return false
+}
+
+// Summary describes a finished scan. In structured formats it is emitted as
+// the last record, tagged with type "summary".
+type Summary struct {
+	Type            string         `json:"type"`
+	ScanID          string         `json:"scan_id"`
+	Duration        string         `json:"duration"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Scanned         int64          `json:"scanned"`
+	CandidateHash   string         `json:"candidate_hash"`
+	Requests        int64          `json:"requests"`
+	CanaryRequests  int64          `json:"canary_requests,omitempty"`
+	Errors          int            `json:"errors"`
+	Counts          map[string]int `json:"counts"`
+	Extensions      map[string]int `json:"extensions,omitempty"`
+	Skipped         int64          `json:"skipped,omitempty"`
+	Retries         int64          `json:"retries,omitempty"`
+
+	RetryBudgetExhausted bool  `json:"retry_budget_exhausted,omitempty"`
+	AllowlistAdded       int64 `json:"allowlist_added,omitempty"`
+	DenylistRemoved      int64 `json:"denylist_removed,omitempty"`
+	// RequestsSavedEstimate is one request per probe answering 200, not a
+	// measurement.
+	RequestsSavedEstimate int64 `json:"requests_saved_estimate,omitempty"`
+
+	// Aborted is why -max-errors stopped the scan early, if it did.
+	Aborted string `json:"aborted,omitempty"`
+
+	// Latency holds the -latency-report percentiles.
+	Latency *LatencyReport `json:"latency,omitempty"`
+
+	// nameLists records whether -allowlist-file or -denylist-file was used,
+	// which decides if the text summary mentions them.
+	nameLists bool
+}
+
+func newSummary(duration time.Duration) Summary {
+	return Summary{
+		Type:            "summary",
+		Duration:        duration.String(),
+		DurationSeconds: duration.Seconds(),
+		Counts:          make(map[string]int),
+	}
+}
+
+// formatExtensions renders an extension histogram most common first, so
+// rare extensions trail the list where they stand out.
+func formatExtensions(counts map[string]int) string {
+	exts := make([]string, 0, len(counts))
+	for ext := range counts {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		if counts[exts[i]] != counts[exts[j]] {
+			return counts[exts[i]] > counts[exts[j]]
+		}
+		return exts[i] < exts[j]
+	})
+	parts := make([]string, len(exts))
+	for i, ext := range exts {
+		parts[i] = fmt.Sprintf("%s: %d", ext, counts[ext])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// findingRecord tags a Result with its record type in structured output.
+type findingRecord struct {
+	Type string `json:"type"`
+	Result
+}
+
+// OutputWriter renders findings and the closing summary in one format.
+// Writers do no buffering of their own and never close the underlying
+// writer: Close only terminates the framing of the format.
+type OutputWriter interface {
+	Write(r Result) error
+	WriteSummary(sum Summary) error
+	Close() error
+}
+
+// newOutputWriter returns the writer for format. Unknown results are only
+// rendered in verbose mode.
+func newOutputWriter(w io.Writer, format string, verbose bool) OutputWriter {
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: w, verbose: verbose}
+	case FormatNDJSON:
+		return &ndjsonWriter{w: w, verbose: verbose}
+	case FormatCSV:
+		return &csvWriter{w: w, verbose: verbose}
+	case FormatSARIF:
+		return &sarifWriter{w: w, verbose: verbose}
+	case FormatTemplate:
+		return &templateWriter{w: w, verbose: verbose}
+	}
+	return &textWriter{w: w, verbose: verbose}
+}
+
+// writeLines writes lines in a single call, so records written to an
+// unbuffered terminal are never interleaved with log output.
+func writeLines(w io.Writer, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// textWriter renders findings as human-readable lines. Text findings may
+// span several lines.
+type textWriter struct {
+	w       io.Writer
+	verbose bool
+}
+
+func (t *textWriter) Write(r Result) error {
+	return writeLines(t.w, formatResult(r, t.verbose))
+}
+
+func (t *textWriter) WriteSummary(sum Summary) error {
+	completed := fmt.Sprintf("Scan completed in %s. Scanned %d buckets with %d requests.", sum.Duration, sum.Scanned, sum.Requests)
+	if sum.CanaryRequests > 0 {
+		completed = fmt.Sprintf("Scan completed in %s. Scanned %d buckets with %d requests, plus %d canary probes.", sum.Duration, sum.Scanned, sum.Requests, sum.CanaryRequests)
+	}
+	lines := []string{"", completed, "Candidate set hash: " + sum.CandidateHash, "Scan ID: " + sum.ScanID}
+	if saved := sum.RequestsSavedEstimate; saved > 0 {
+		lines = append(lines, fmt.Sprintf("Single-request probing saved an estimated %d requests, one per probe answering 200 (about %.1f%% fewer than a separate existence check per bucket).", saved, 100*float64(saved)/float64(sum.Requests+saved)))
+	}
+	if sum.nameLists {
+		lines = append(lines, fmt.Sprintf("Allowlist added %d names, denylist removed %d names.", sum.AllowlistAdded, sum.DenylistRemoved))
+	}
+	if sum.RetryBudgetExhausted {
+		lines = append(lines, fmt.Sprintf("Retry budget exhausted after %d retries; later failures were not retried.", sum.Retries))
+	}
+	if len(sum.Extensions) > 0 {
+		lines = append(lines, "Object extensions: "+formatExtensions(sum.Extensions))
+	}
+	if l := sum.Latency; l != nil {
+		lines = append(lines, fmt.Sprintf("Latency over %d requests: %s; time to first byte %s.", l.Requests, l.Latency, l.TTFB))
+	}
+	if sum.Aborted != "" {
+		lines = append(lines, "Scan aborted early after "+sum.Aborted+"; results are incomplete.")
+	}
+	if sum.Skipped > 0 {
+		lines = append(lines, fmt.Sprintf("Skipped %d candidates for keywords that already had a hit.", sum.Skipped))
+	}
+	return writeLines(t.w, lines)
+}
+
+func (t *textWriter) Close() error { return nil }
+
+// jsonWriter frames every record, the summary included, as one JSON array.
+type jsonWriter struct {
+	w       io.Writer
+	verbose bool
+	records int
+}
+
+func (j *jsonWriter) Write(r Result) error {
+	if verboseOnly(r.Classification) && !j.verbose {
+		return nil
+	}
+	return j.writeRecord(findingRecord{Type: "finding", Result: r})
+}
+
+func (j *jsonWriter) WriteSummary(sum Summary) error {
+	return j.writeRecord(sum)
+}
+
+func (j *jsonWriter) writeRecord(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	prefix := ",\n"
+	if j.records == 0 {
+		prefix = "[\n"
+	}
+	j.records++
+	_, err = io.WriteString(j.w, prefix+string(data))
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	closing := "\n]\n"
+	if j.records == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
+
+// ndjsonWriter writes one JSON object per line.
+type ndjsonWriter struct {
+	w       io.Writer
+	verbose bool
+}
+
+func (n *ndjsonWriter) Write(r Result) error {
+	if verboseOnly(r.Classification) && !n.verbose {
+		return nil
+	}
+	return n.writeRecord(findingRecord{Type: "finding", Result: r})
+}
+
+func (n *ndjsonWriter) WriteSummary(sum Summary) error {
+	return n.writeRecord(sum)
+}
+
+func (n *ndjsonWriter) writeRecord(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return writeLines(n.w, []string{string(data)})
+}
+
+func (n *ndjsonWriter) Close() error { return nil }
+
+// csvWriter writes one row per finding under a header row. CSV has no room
+// for a summary row, so the summary is dropped.
+type csvWriter struct {
+	w       io.Writer
+	verbose bool
+	header  bool
+}
+
+func (c *csvWriter) Write(r Result) error {
+	if verboseOnly(r.Classification) && !c.verbose {
+		return nil
+	}
+	lines := []string{csvLine([]string{
+		r.Bucket,
+		r.Keyword,
+		r.Classification,
+		strconv.Itoa(r.StatusCode),
+		strconv.Itoa(r.Severity),
+		strconv.Itoa(r.ObjectCount),
+		r.URL,
+		r.Error,
+		r.ScanID,
+	})}
+	if !c.header {
+		lines = append([]string{csvLine(csvHeader)}, lines...)
+		c.header = true
+	}
+	return writeLines(c.w, lines)
+}
+
+func (c *csvWriter) WriteSummary(Summary) error { return nil }
+
+func (c *csvWriter) Close() error { return nil }
+
+// csvLine encodes a single CSV row without the trailing newline.
+func csvLine(fields []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(fields)
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// resultOutput writes rendered findings to one or more files. With more than
+// one shard, each bucket is hashed into a fixed shard so downstream
+// processors can each take one file; with -split-by-keyword each keyword
+// gets its own file instead. With rotateSize set, a shard file that
+// grows past it is closed with its framing intact and renamed to path.1,
+// path.2 and so on, and a fresh file is started. All writes come from the
+// single consumer goroutine, so rotation needs no locking.
+type resultOutput struct {
+	format     string
+	verbose    bool
+	rotateSize int64
+	paths      []string
+	files      []*os.File
+	buffers    []*bufio.Writer
+	counters   []*countingWriter
+	writers    []OutputWriter
+	rotations  []int
+
+	// byKeyword maps sanitized keywords to their shard with
+	// -split-by-keyword; files are then created as keywords first appear.
+	byKeyword map[string]int
+	basePath  string
+}
+
+// countingWriter counts the bytes that reach the underlying writer. It sits
+// above the file's buffer, so buffered bytes are counted too.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// shardPath inserts the shard index before the extension: out.json with
+// index 2 becomes out-2.json.
+func shardPath(path string, index int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), index, ext)
+}
+
+// parseSize parses a byte size such as 500000, 64KB, 10MB or 1GB.
+func parseSize(input string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(input))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSuffix(value, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 500000, 64KB, 10MB or 1GB)", input)
+	}
+	return n * multiplier, nil
+}
+
+func openResultOutput(path string, shards int, format string, verbose bool, rotateSize int64) (*resultOutput, error) {
+	if shards < 1 {
+		shards = 1
+	}
+	out := &resultOutput{format: format, verbose: verbose, rotateSize: rotateSize}
+	for i := 0; i < shards; i++ {
+		name := path
+		if shards > 1 {
+			name = shardPath(path, i)
+		}
+		out.paths = append(out.paths, name)
+		out.rotations = append(out.rotations, 0)
+		if err := out.open(i); err != nil {
+			out.Close()
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// openKeywordOutput returns an output that writes the findings of each
+// keyword to its own file, named like shardPath with the keyword in place
+// of the index: findings.json becomes findings-acme.json.
+func openKeywordOutput(path, format string, verbose bool, rotateSize int64) *resultOutput {
+	return &resultOutput{format: format, verbose: verbose, rotateSize: rotateSize, byKeyword: make(map[string]int), basePath: path}
+}
+
+// sanitizeFileName reduces name to characters that are safe in a file name
+// on every platform.
+func sanitizeFileName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return strings.TrimLeft(b.String(), ".")
+}
+
+// open (re)creates the file of shard i along with its writer.
+func (o *resultOutput) open(i int) error {
+	file, err := os.Create(o.paths[i])
+	if err != nil {
+		return err
+	}
+	buffer := bufio.NewWriter(file)
+	counter := &countingWriter{w: buffer}
+	writer := newOutputWriter(counter, o.format, o.verbose)
+	if i == len(o.files) {
+		o.files = append(o.files, file)
+		o.buffers = append(o.buffers, buffer)
+		o.counters = append(o.counters, counter)
+		o.writers = append(o.writers, writer)
+	} else {
+		o.files[i], o.buffers[i], o.counters[i], o.writers[i] = file, buffer, counter, writer
+	}
+	return nil
+}
+
+// finish terminates the framing of shard i, flushes it and closes its file.
+func (o *resultOutput) finish(i int) error {
+	err := o.writers[i].Close()
+	if flushErr := o.buffers[i].Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := o.files[i].Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// rotate closes shard i, moves it aside as the next numbered file and
+// starts a new one in its place.
+func (o *resultOutput) rotate(i int) error {
+	if err := o.finish(i); err != nil {
+		return err
+	}
+	o.rotations[i]++
+	if err := os.Rename(o.paths[i], fmt.Sprintf("%s.%d", o.paths[i], o.rotations[i])); err != nil {
+		return err
+	}
+	return o.open(i)
+}
+
+func (o *resultOutput) shardFor(r Result) (int, error) {
+	if o.byKeyword != nil {
+		return o.keywordShard(r.Keyword)
+	}
+	if len(o.writers) == 1 {
+		return 0, nil
+	}
+	h := fnv.New32a()
+	h.Write([]byte(r.Bucket))
+	return int(h.Sum32() % uint32(len(o.writers))), nil
+}
+
+// keywordShard returns the shard of keyword, creating its file on first use.
+// Findings not attributed to a keyword share an "unattributed" file.
+func (o *resultOutput) keywordShard(keyword string) (int, error) {
+	name := sanitizeFileName(keyword)
+	if name == "" {
+		name = "unattributed"
+	}
+	if i, ok := o.byKeyword[name]; ok {
+		return i, nil
+	}
+	ext := filepath.Ext(o.basePath)
+	i := len(o.paths)
+	o.paths = append(o.paths, fmt.Sprintf("%s-%s%s", strings.TrimSuffix(o.basePath, ext), name, ext))
+	o.rotations = append(o.rotations, 0)
+	if err := o.open(i); err != nil {
+		o.paths = o.paths[:i]
+		o.rotations = o.rotations[:i]
+		return 0, err
+	}
+	o.byKeyword[name] = i
+	return i, nil
+}
+
+// Write appends r to its shard, rotating the shard once it exceeds the
+// size limit. Write errors stick to the shard's buffer and are reported by
+// Close.
+func (o *resultOutput) Write(r Result) error {
+	i, err := o.shardFor(r)
+	if err != nil {
+		fatal("Could not create output file", "keyword", r.Keyword, "err", err)
+	}
+	o.writers[i].Write(r)
+	if o.rotateSize > 0 && o.counters[i].n >= o.rotateSize {
+		if err := o.rotate(i); err != nil {
+			fatal("Could not rotate output file", "path", o.paths[i], "err", err)
+		}
+	}
+	return nil
+}
+
+// WriteSummary appends the summary to every shard, so each file describes
+// the run it belongs to. Text files carry findings only; the human summary
+// is meant for the terminal.
+func (o *resultOutput) WriteSummary(sum Summary) error {
+	if o.format == FormatText {
+		return nil
+	}
+	for _, w := range o.writers {
+		w.WriteSummary(sum)
+	}
+	return nil
+}
+
+// Close flushes and closes every shard, returning the first error seen.
+func (o *resultOutput) Close() error {
+	var firstErr error
+	for i := range o.files {
+		if err := o.finish(i); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// objectRecord is one listed object in the -objects-output stream.
+type objectRecord struct {
+	Type      string `json:"type"`
+	Bucket    string `json:"bucket"`
+	Keyword   string `json:"keyword,omitempty"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+	SameAs    string `json:"same_content_as,omitempty"`
+	ScanID    string `json:"scan_id,omitempty"`
+}
+
+// objectStream writes the objects of every listing to their own NDJSON
+// file, one record per object, so the inventory can be consumed apart from
+// the bucket findings.
+type objectStream struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func openObjectStream(path string) (*objectStream, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &objectStream{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// Write records the listed objects of r, duplicates included.
+func (o *objectStream) Write(r Result) error {
+	record := objectRecord{Type: "object", Bucket: r.Bucket, Keyword: r.Keyword, ScanID: r.ScanID}
+	write := func(name, sameAs string) error {
+		record.Name, record.URL, record.SameAs = name, objectURL(r.Bucket, name), sameAs
+		record.Sensitive = slices.Contains(r.Sensitive, name)
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return writeLines(o.w, []string{string(data)})
+	}
+	for _, name := range r.Objects {
+		if err := write(name, ""); err != nil {
+			return err
+		}
+	}
+	for _, dup := range r.Duplicates {
+		if err := write(dup.Name, dup.FirstSeen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *objectStream) Close() error {
+	if err := o.w.Flush(); err != nil {
+		o.file.Close()
+		return err
+	}
+	return o.file.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// defaultPins are the base64 SHA-256 hashes of the SubjectPublicKeyInfo of
+// the roots Google serves its APIs from: GTS Root R1 to R4, and the
+// GlobalSign Root CA and GlobalSign ECC Root CA R4 that cross-sign them.
+var defaultPins = []string{
+	"hxqRlPTu1bMS/0DITB1SSu0vd4u/8l8TjPgfaAp63Gc=", // GTS Root R1
+	"Vfd95BwDeSQo+NUYxVEEIlvkOlWY2SalKK1lPhzOx78=", // GTS Root R2
+	"QXnt2YHvdHR3tJYmQIr0Paosp6t/nggsEGD4QJZ3Q0g=", // GTS Root R3
+	"mEflZT5enoR1FuXLgYYGqnVEoZvmf9c2bVBpiOjYQ0c=", // GTS Root R4
+	"K87oWBWM9UZfyddvDfoxL+8lpNyoUB2ptGtn0fv6G2Q=", // GlobalSign Root CA
+	"CLOmM1/OXvSPjw5UOYbAf9GKOxImEp9hhku9W90fHMk=", // GlobalSign ECC Root CA R4
+}
+
+// parsePins parses a comma-separated list of base64 SPKI SHA-256 pins, with
+// an optional "sha256/" prefix as used by HPKP and curl.
+func parsePins(value string) ([]string, error) {
+	var pins []string
+	for _, pin := range strings.Split(value, ",") {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		if pin == "" {
+			continue
+		}
+		if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid pin %q (expected a base64 SHA-256 hash)", pin)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// pinVerifier returns a tls.Config.VerifyConnection hook that, for the
+// Google API hosts only, rejects connections whose verified chain contains
+// none of the pinned public keys. Other hosts, such as the wordlist download,
+// are verified as usual.
+func pinVerifier(pins []string) func(tls.ConnectionState) error {
+	pinned := make(map[string]bool)
+	for _, pin := range pins {
+		pinned[pin] = true
+	}
+	hosts := make(map[string]bool)
+	for _, base := range []string{storageHost, jsonAPIHost} {
+		if u, err := url.Parse(base); err == nil {
+			hosts[u.Hostname()] = true
+		}
+	}
+
+	return func(cs tls.ConnectionState) error {
+		if !hosts[cs.ServerName] {
+			return nil
+		}
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pinned[base64.StdEncoding.EncodeToString(sum[:])] {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("certificate chain for %s matches no pinned public key", cs.ServerName)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// profiles bundle coherent values for the tuning flags. "balanced" matches
+// the flag defaults.
+var profiles = map[string]map[string]string{
+	"polite": {
+		"c":         "3",
+		"list-conc": "1",
+		"delay":     "500ms",
+		"retries":   "3",
+	},
+	"balanced": {
+		"c":         "10",
+		"list-conc": "5",
+		"delay":     "0s",
+		"retries":   "0",
+	},
+	"aggressive": {
+		"c":         "50",
+		"list-conc": "20",
+		"delay":     "0s",
+		"retries":   "0",
+	},
+}
+
+// applyProfile sets the flags bundled in the named profile, leaving alone
+// any flag that was given explicitly on the command line.
+func applyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	values, ok := profiles[name]
+	if !ok {
+		var names []string
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown -profile %q (expected %s)", name, strings.Join(names, ", "))
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for key, value := range values {
+		if explicit[key] {
+			continue
+		}
+		if err := flag.Set(key, value); err != nil {
+			return fmt.Errorf("profile %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// sarifSchema is the SARIF version written by -format sarif.
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// sarifRuleText describes each classification as a SARIF rule. Every
+// classification seen in a run becomes one rule.
+var sarifRuleText = map[string]string{
+	ClassExists:           "Bucket exists",
+	ClassListable:         "Bucket contents are publicly listable",
+	ClassRedirect:         "Bucket name redirects",
+	ClassUnknown:          "Unexpected response to the bucket probe",
+	ClassError:            "Bucket probe failed",
+	ClassRequesterPays:    "Requester-pays bucket exists",
+	ClassCustomDomain:     "Custom domain is served by a bucket",
+	ClassAuthRequired:     "Bucket probe requires authentication",
+	ClassEndpointMismatch: "Endpoints disagree about bucket access",
+	ClassInvalidName:      "Bucket name is invalid",
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations,omitempty"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool    `json:"executionSuccessful"`
+	Properties          Summary `json:"properties"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties Result          `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+// sarifWriter collects findings and writes them as a single SARIF log on
+// Close, since the format has no streaming form. The summary becomes the
+// run's invocation.
+type sarifWriter struct {
+	w       io.Writer
+	verbose bool
+	rules   []sarifRule
+	seen    map[string]bool
+	results []sarifResult
+	summary *Summary
+}
+
+func (s *sarifWriter) Write(r Result) error {
+	if verboseOnly(r.Classification) && !s.verbose {
+		return nil
+	}
+	if !s.seen[r.Classification] {
+		if s.seen == nil {
+			s.seen = make(map[string]bool)
+		}
+		s.seen[r.Classification] = true
+		text, ok := sarifRuleText[r.Classification]
+		if !ok {
+			text = r.Classification
+		}
+		s.rules = append(s.rules, sarifRule{ID: r.Classification, ShortDescription: sarifMessage{Text: text}})
+	}
+
+	result := sarifResult{
+		RuleID:     r.Classification,
+		Level:      sarifLevel(r.Severity),
+		Message:    sarifMessage{Text: formatResult(r, true)[0]},
+		Locations:  make([]sarifLocation, 1),
+		Properties: r,
+	}
+	result.Locations[0].PhysicalLocation.ArtifactLocation.URI = r.URL
+	if r.URL == "" {
+		result.Locations[0].PhysicalLocation.ArtifactLocation.URI = "gs://" + r.Bucket
+	}
+	s.results = append(s.results, result)
+	return nil
+}
+
+func (s *sarifWriter) WriteSummary(sum Summary) error {
+	s.summary = &sum
+	return nil
+}
+
+func (s *sarifWriter) Close() error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "gcpenum",
+			Version:        version,
+			InformationURI: "https://github.com/Vulnpire/gcpenum",
+			Rules:          s.rules,
+		}},
+		Results: s.results,
+	}
+	if run.Tool.Driver.Rules == nil {
+		run.Tool.Driver.Rules = []sarifRule{}
+	}
+	if run.Results == nil {
+		run.Results = []sarifResult{}
+	}
+	if s.summary != nil {
+		run.Invocations = []sarifInvocation{{ExecutionSuccessful: true, Properties: *s.summary}}
+	}
+	data, err := json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeLines(s.w, []string{string(data)})
+}
+
+// sarifLevel maps a severity to the SARIF result level.
+func sarifLevel(severity int) string {
+	switch {
+	case severity >= SeverityHigh:
+		return "error"
+	case severity == SeverityMedium:
+		return "warning"
+	}
+	return "note"
+}
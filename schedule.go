@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+)
+
+// Request classes competing for per-host slots.
+const (
+	classDiscovery = iota
+	classListing
+	classDownload
+	numRequestClasses
+)
+
+// hostScheduler caps the number of simultaneous requests per upstream host.
+// When a slot frees up and requests of several classes are waiting, the
+// classes take turns, so a flood of listing requests cannot starve
+// discovery probes (or the other way round).
+type hostScheduler struct {
+	limit int
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	active  int
+	waiting [numRequestClasses][]chan struct{}
+	next    int
+}
+
+func newHostScheduler(limit int) *hostScheduler {
+	return &hostScheduler{limit: limit, hosts: make(map[string]*hostSlots)}
+}
+
+// hostOf returns the host a request URL targets.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
+
+// acquire blocks until a slot for host is available to a request of class.
+func (h *hostScheduler) acquire(host string, class int) {
+	h.mu.Lock()
+	slots := h.hosts[host]
+	if slots == nil {
+		slots = &hostSlots{}
+		h.hosts[host] = slots
+	}
+	if slots.active < h.limit && slots.queued() == 0 {
+		slots.active++
+		h.mu.Unlock()
+		return
+	}
+	ready := make(chan struct{})
+	slots.waiting[class] = append(slots.waiting[class], ready)
+	h.mu.Unlock()
+	<-ready
+}
+
+// release frees a slot for host, handing it straight to the next waiting
+// request in round-robin class order.
+func (h *hostScheduler) release(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	slots := h.hosts[host]
+	for i := 0; i < numRequestClasses; i++ {
+		class := (slots.next + i) % numRequestClasses
+		if len(slots.waiting[class]) == 0 {
+			continue
+		}
+		ready := slots.waiting[class][0]
+		slots.waiting[class] = slots.waiting[class][1:]
+		slots.next = (class + 1) % numRequestClasses
+		close(ready)
+		return
+	}
+	slots.active--
+}
+
+func (s *hostSlots) queued() int {
+	n := 0
+	for _, w := range s.waiting {
+		n += len(w)
+	}
+	return n
+}
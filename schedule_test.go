@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n requests are queued for host.
+func waitQueued(t *testing.T, h *hostScheduler, host string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.mu.Lock()
+		queued := 0
+		if slots := h.hosts[host]; slots != nil {
+			queued = slots.queued()
+		}
+		h.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests queued for %s, want %d", queued, host, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHostSchedulerTakesTurns(t *testing.T) {
+	const host = "storage.googleapis.com"
+	h := newHostScheduler(1)
+	h.acquire(host, classListing)
+
+	// Queue a backlog of listing requests ahead of two discovery probes
+	// and a download, one at a time so the queue order is known.
+	classes := []int{classListing, classListing, classListing, classListing, classDiscovery, classDiscovery, classDownload}
+	granted := make(chan int, len(classes))
+	for i, class := range classes {
+		go func() {
+			h.acquire(host, class)
+			granted <- class
+		}()
+		waitQueued(t, h, host, i+1)
+	}
+
+	var order []int
+	for range classes {
+		h.release(host)
+		order = append(order, <-granted)
+	}
+	h.release(host)
+
+	// Round-robin from discovery: each class gets a turn while it has
+	// requests waiting, so the probes are not stuck behind the listings.
+	want := []int{classDiscovery, classListing, classDownload, classDiscovery, classListing, classListing, classListing}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("grant order %v, want %v", order, want)
+		}
+	}
+	if slots := h.hosts[host]; slots.active != 0 || slots.queued() != 0 {
+		t.Errorf("%d active and %d queued after all releases", slots.active, slots.queued())
+	}
+}
+
+func TestHostSchedulerLimit(t *testing.T) {
+	const limit = 3
+	h := newHostScheduler(limit)
+	var active, peak [2]atomic.Int64
+	hosts := []string{"storage.googleapis.com", "www.googleapis.com"}
+
+	var wg sync.WaitGroup
+	for i := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host := i % len(hosts)
+			h.acquire(hosts[host], i%numRequestClasses)
+			n := active[host].Add(1)
+			for {
+				p := peak[host].Load()
+				if n <= p || peak[host].CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(100 * time.Microsecond)
+			active[host].Add(-1)
+			h.release(hosts[host])
+		}()
+	}
+	wg.Wait()
+
+	for i, host := range hosts {
+		if p := peak[i].Load(); p > limit {
+			t.Errorf("%s had %d requests in flight, limit %d", host, p, limit)
+		}
+	}
+}
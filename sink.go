@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataTokenURL serves access tokens for the attached service account on
+// GCE, Cloud Run and Cloud Functions.
+var metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// objectSink collects findings and uploads them, rendered in the -format, to
+// a gs:// or s3:// object. Each upload replaces the object with the full
+// document so far, so a periodic upload always leaves a complete file
+// behind. If the final upload fails the document is written to a local file
+// named after the object instead.
+type objectSink struct {
+	scheme  string
+	bucket  string
+	key     string
+	format  string
+	verbose bool
+	client  *http.Client
+
+	mu      sync.Mutex
+	results []Result
+}
+
+// parseSinkURL splits a gs://bucket/key or s3://bucket/key target.
+func parseSinkURL(target string) (scheme, bucket, key string, err error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "gs" && u.Scheme != "s3") || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return "", "", "", fmt.Errorf("invalid sink %q (expected gs://bucket/key or s3://bucket/key)", target)
+	}
+	return u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// newObjectSink returns a sink for target that uploads with client.
+func newObjectSink(target, format string, verbose bool, client *http.Client) (*objectSink, error) {
+	scheme, bucket, key, err := parseSinkURL(target)
+	if err != nil {
+		return nil, err
+	}
+	return &objectSink{
+		scheme:  scheme,
+		bucket:  bucket,
+		key:     key,
+		format:  format,
+		verbose: verbose,
+		client:  client,
+	}, nil
+}
+
+// Add buffers a finding for the next upload.
+func (s *objectSink) Add(r Result) {
+	s.mu.Lock()
+	s.results = append(s.results, r)
+	s.mu.Unlock()
+}
+
+// run uploads the findings so far every interval until stop is closed.
+// Failed periodic uploads are only logged; the final upload retries them.
+func (s *objectSink) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.upload(s.render(nil)); err != nil {
+				slog.Warn("Periodic sink upload failed", "sink", s.String(), "err", err)
+			}
+		}
+	}
+}
+
+// Finish uploads the complete document with its summary, falling back to a
+// local file when the upload fails.
+func (s *objectSink) Finish(sum Summary) {
+	data := s.render(&sum)
+	err := s.upload(data)
+	if err == nil {
+		slog.Info("Uploaded findings", "sink", s.String(), "bytes", len(data))
+		return
+	}
+	local := path.Base(s.key)
+	slog.Error("Could not upload findings, writing them locally instead", "sink", s.String(), "path", local, "err", err)
+	if err := ioutil.WriteFile(local, data, 0o644); err != nil {
+		slog.Error("Could not write findings", "path", local, "err", err)
+	}
+}
+
+func (s *objectSink) String() string {
+	return s.scheme + "://" + s.bucket + "/" + s.key
+}
+
+// render renders the findings buffered so far as one document. As with -o,
+// text output carries no summary.
+func (s *objectSink) render(sum *Summary) []byte {
+	s.mu.Lock()
+	results := s.results[:len(s.results):len(s.results)]
+	s.mu.Unlock()
+
+	var buf bytes.Buffer
+	w := newOutputWriter(&buf, s.format, s.verbose)
+	for _, r := range results {
+		w.Write(r)
+	}
+	if sum != nil && s.format != FormatText {
+		w.WriteSummary(*sum)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func (s *objectSink) upload(data []byte) error {
+	var req *http.Request
+	var err error
+	if s.scheme == "gs" {
+		req, err = s.gcsRequest(data)
+	} else {
+		req, err = s.s3Request(data)
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// contentType returns the MIME type of the -format.
+func (s *objectSink) contentType() string {
+	switch s.format {
+	case FormatJSON, FormatSARIF:
+		return "application/json"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// gcsRequest builds a simple media upload to the JSON API. The access token
+// comes from GOOGLE_OAUTH_ACCESS_TOKEN, or else from the metadata server of
+// the machine the scan runs on.
+func (s *objectSink) gcsRequest(data []byte) (*http.Request, error) {
+	token, err := s.gcsToken()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", storageHost, url.PathEscape(s.bucket), url.QueryEscape(s.key))
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", s.contentType())
+	return req, nil
+}
+
+func (s *objectSink) gcsToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("no GOOGLE_OAUTH_ACCESS_TOKEN set and the metadata server is unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("metadata server returned no access token")
+	}
+	return token.AccessToken, nil
+}
+
+// s3Request builds a PUT signed with AWS Signature Version 4 from the
+// standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and
+// AWS_REGION variables. AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL points the
+// upload at an S3-compatible service, addressed path-style.
+func (s *objectSink) s3Request(data []byte) (*http.Request, error) {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var u string
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		u = strings.TrimSuffix(endpoint, "/") + "/" + s.bucket + "/" + s3EscapePath(s.key)
+	} else {
+		u = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, region, s3EscapePath(s.key))
+	}
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", s.contentType())
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, data, accessKey, secretKey, region, time.Now().UTC())
+	return req, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// s3EscapePath escapes each segment of an object key the way SigV4 expects
+// for S3: RFC 3986 unreserved characters stay, slashes separate segments.
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+// signV4 adds the AWS Signature Version 4 headers for service s3 to req.
+func signV4(req *http.Request, payload []byte, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestObjectSinkUploadsThroughProxy(t *testing.T) {
+	quietLogs(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "http://s3.example.invalid")
+
+	// A forward proxy sees plain HTTP requests with their absolute URL.
+	var uploads atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.String() == "http://s3.example.invalid/ci-results/findings.ndjson" {
+			uploads.Add(1)
+		}
+	}))
+	defer proxy.Close()
+	client, err := newHTTPClient(clientOptions{Proxy: proxy.URL, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newObjectSink("s3://ci-results/findings.ndjson", FormatNDJSON, false, &http.Client{Transport: client.Transport, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Add(Result{Bucket: "acme", Classification: ClassListable})
+	if err := sink.upload(sink.render(nil)); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if uploads.Load() != 1 {
+		t.Errorf("proxy saw %d uploads, want 1", uploads.Load())
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxSiteFileBytes bounds how much of a robots.txt or sitemap is read, and
+// maxSitemaps how many sitemaps, nested ones included, are read per bucket.
+const (
+	maxSiteFileBytes = 1 << 20
+	maxSitemaps      = 5
+)
+
+// probeSitePaths handles buckets serving a static site: it reads their
+// robots.txt and sitemaps and requests up to s.sitePaths of the objects they
+// reference, recording those answering 200 that the listing did not show.
+// Sites link assets that are never listed, so this reaches objects a
+// wordlist would not.
+func (s *scanner) probeSitePaths(result *Result) {
+	if s.sitePaths <= 0 || !s.isStaticSite(result) {
+		return
+	}
+	result.StaticSite = true
+
+	var paths []string
+	for _, path := range s.siteReferences(result.Bucket) {
+		if len(paths) == s.sitePaths {
+			break
+		}
+		if !slices.Contains(result.Objects, path) && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+
+	served := make([]bool, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		s.probeSem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-s.probeSem }()
+			resp, err := s.headAs(classDownload, objectURL(result.Bucket, path))
+			if err != nil {
+				slog.Debug("Could not probe site path", "bucket", result.Bucket, "path", path, "err", err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			served[i] = resp.StatusCode == 200
+		}()
+	}
+	wg.Wait()
+	for i, path := range paths {
+		if served[i] {
+			result.SiteObjects = append(result.SiteObjects, path)
+		}
+	}
+}
+
+// isStaticSite reports whether a bucket serves a site, judged by an
+// index.html in its listing or, failing that, one that can be fetched.
+func (s *scanner) isStaticSite(result *Result) bool {
+	if slices.Contains(result.Objects, "index.html") {
+		return true
+	}
+	resp, err := s.headAs(classDownload, objectURL(result.Bucket, "index.html"))
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode == 200
+}
+
+// siteReferences returns the object paths referenced by a bucket's
+// robots.txt and sitemaps, in the order found. Sitemaps are sitemap.xml
+// plus those named in robots.txt or in a sitemap index.
+func (s *scanner) siteReferences(bucket string) []string {
+	var paths []string
+	sitemaps := []string{"sitemap.xml"}
+	if data := s.fetchSiteFile(bucket, "robots.txt"); data != nil {
+		lines := bufio.NewScanner(bytes.NewReader(data))
+		for lines.Scan() {
+			line, _, _ := strings.Cut(lines.Text(), "#")
+			field, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			path, ok := siteObjectPath(bucket, strings.TrimSpace(value))
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(field)) {
+			case "allow", "disallow":
+				paths = append(paths, path)
+			case "sitemap":
+				sitemaps = append(sitemaps, path)
+			}
+		}
+	}
+
+	for i := 0; i < len(sitemaps) && i < maxSitemaps; i++ {
+		data := s.fetchSiteFile(bucket, sitemaps[i])
+		if data == nil {
+			continue
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(data))
+		inIndex := false
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			switch start.Name.Local {
+			case "sitemapindex":
+				inIndex = true
+			case "loc":
+				var loc string
+				if decoder.DecodeElement(&loc, &start) != nil {
+					continue
+				}
+				path, ok := siteObjectPath(bucket, strings.TrimSpace(loc))
+				switch {
+				case !ok:
+				case inIndex:
+					if !slices.Contains(sitemaps, path) {
+						sitemaps = append(sitemaps, path)
+					}
+				default:
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// fetchSiteFile downloads a robots.txt or sitemap, returning nil unless the
+// bucket serves it.
+func (s *scanner) fetchSiteFile(bucket, path string) []byte {
+	resp, err := s.getAs(classDownload, objectURL(bucket, path))
+	if err != nil {
+		slog.Debug("Could not fetch site file", "bucket", bucket, "path", path, "err", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSiteFileBytes))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// siteObjectPath maps a path or URL referenced by a site to the name of an
+// object in bucket. URLs on other hosts and robots.txt wildcard rules have
+// no such object. Directory paths map to their index.html, as GCS serves
+// them.
+func siteObjectPath(bucket, ref string) (string, bool) {
+	u, err := url.Parse(ref)
+	if ref == "" || err != nil || strings.Contains(u.Path, "*") {
+		return "", false
+	}
+	path := u.Path
+	if u.Host != "" {
+		host := strings.ToLower(u.Hostname())
+		switch {
+		case host == bucket || host == bucket+".storage.googleapis.com":
+		case host == "storage.googleapis.com" && strings.HasPrefix(path, "/"+bucket+"/"):
+			path = strings.TrimPrefix(path, "/"+bucket)
+		default:
+			return "", false
+		}
+	}
+	path = strings.TrimSuffix(path, "$")
+	if strings.HasSuffix(path, "/") || path == "" {
+		path += "index.html"
+	}
+	return strings.TrimLeft(path, "/"), true
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// FormatTemplate renders findings with the user's -template-file. It is not
+// a -format value; -template-file selects it.
+const FormatTemplate = "template"
+
+// Templates loaded from -template-file and -summary-template-file. A nil
+// summaryTemplate leaves the summary out.
+var findingTemplate, summaryTemplate *template.Template
+
+// templateFuncs are available to both templates on top of the built-ins.
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// loadTemplate parses a text/template file, so that syntax errors and
+// unknown functions are reported before the scan starts.
+func loadTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(data))
+}
+
+// templateWriter executes findingTemplate with each Result and
+// summaryTemplate with the Summary. The templates control all layout,
+// trailing newlines included.
+type templateWriter struct {
+	w       io.Writer
+	verbose bool
+}
+
+func (t *templateWriter) Write(r Result) error {
+	if verboseOnly(r.Classification) && !t.verbose {
+		return nil
+	}
+	return t.execute(findingTemplate, r)
+}
+
+func (t *templateWriter) WriteSummary(sum Summary) error {
+	if summaryTemplate == nil {
+		return nil
+	}
+	return t.execute(summaryTemplate, sum)
+}
+
+// execute renders a record in full before writing it, so a template that
+// fails halfway leaves no partial record behind. Failures are logged here,
+// as callers do not check write errors.
+func (t *templateWriter) execute(tmpl *template.Template, data any) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		slog.Warn("Could not render template", "template", tmpl.Name(), "err", err)
+		return err
+	}
+	_, err := t.w.Write(buf.Bytes())
+	return err
+}
+
+func (t *templateWriter) Close() error { return nil }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+)
+
+// tuiClasses is the order in which classification counters are shown.
+// Classifications introduced via -status-map are appended as they appear.
+var tuiClasses = []string{ClassExists, ClassListable, ClassRedirect, ClassRequesterPays, ClassAuthRequired, ClassCustomDomain, ClassEndpointMismatch, ClassInvalidName, ClassUnknown, ClassError}
+
+// tui renders a live view of the scan: a header with progress, rate and
+// per-classification counts, followed by the most recent findings.
+type tui struct {
+	mu       sync.Mutex
+	start    time.Time
+	classes  []string
+	counts   map[string]int
+	findings []string
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// canRenderTUI reports whether stdout can show the TUI, which is drawn with
+// plain ANSI escape sequences: it must be a terminal, and not one that
+// declares itself unable to move the cursor.
+func canRenderTUI() bool {
+	return isTerminal(os.Stdout) && os.Getenv("TERM") != "dumb"
+}
+
+func newTUI() *tui {
+	return &tui{
+		classes: append([]string(nil), tuiClasses...),
+		counts:  make(map[string]int),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start switches to the alternate screen and redraws periodically until Stop.
+func (t *tui) Start(start time.Time) {
+	t.start = start
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			t.render()
+			select {
+			case <-ticker.C:
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Add records a result and the lines it rendered to.
+func (t *tui) Add(r Result, lines []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !slices.Contains(t.classes, r.Classification) {
+		t.classes = append(t.classes, r.Classification)
+	}
+	t.counts[r.Classification]++
+	t.findings = append(t.findings, lines...)
+}
+
+// Stop restores the terminal and prints the findings so they survive the
+// alternate screen being torn down.
+func (t *tui) Stop() {
+	close(t.stop)
+	<-t.done
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range t.findings {
+		fmt.Println(line)
+	}
+}
+
+func (t *tui) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	scanned := atomic.LoadInt64(&scannedCount)
+	elapsed := time.Since(t.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(scanned) / elapsed.Seconds()
+	}
+
+	t.mu.Lock()
+	header := []string{
+		fmt.Sprintf("gcpenum  scanned %d  %.1f/s  elapsed %s", scanned, rate, elapsed.Truncate(time.Second)),
+	}
+	var counts []string
+	for _, class := range t.classes {
+		counts = append(counts, fmt.Sprintf("%s: %d", class, t.counts[class]))
+	}
+	header = append(header, strings.Join(counts, "  "), strings.Repeat("-", width))
+
+	visible := height - len(header)
+	if visible < 0 {
+		visible = 0
+	}
+	findings := t.findings
+	if len(findings) > visible {
+		findings = findings[len(findings)-visible:]
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for _, line := range append(header, findings...) {
+		b.WriteString(truncateWidth(line, width))
+		b.WriteString("\x1b[K\r\n")
+	}
+	t.mu.Unlock()
+	b.WriteString("\x1b[J")
+	fmt.Print(b.String())
+}
+
+// truncateWidth cuts line to at most cols terminal columns without splitting
+// a rune. East Asian wide and fullwidth runes take two columns and combining
+// marks none, so object names in any script line up with the screen edge.
+func truncateWidth(line string, cols int) string {
+	used := 0
+	for i, r := range line {
+		w := 1
+		if unicode.Is(unicode.Mn, r) {
+			w = 0
+		} else if kind := width.LookupRune(r).Kind(); kind == width.EastAsianWide || kind == width.EastAsianFullwidth {
+			w = 2
+		}
+		if used+w > cols {
+			return line[:i]
+		}
+		used += w
+	}
+	return line
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateWidth(t *testing.T) {
+	tests := []struct {
+		line string
+		cols int
+		want string
+	}{
+		{"landsat-public", 7, "landsat"},
+		{"short", 80, "short"},
+		{"café.txt", 4, "café"},
+		{"cafe\u0301.txt", 4, "cafe\u0301"},
+		{"データ.csv", 5, "デー"},
+		{"データ.csv", 6, "データ"},
+		{"ｆｕｌｌ", 3, "ｆ"},
+		{"", 10, ""},
+	}
+	for _, tt := range tests {
+		got := truncateWidth(tt.line, tt.cols)
+		if got != tt.want {
+			t.Errorf("truncateWidth(%q, %d) = %q, want %q", tt.line, tt.cols, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateWidth(%q, %d) split a rune: %q", tt.line, tt.cols, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// latestReleaseURL is the GitHub API endpoint describing the newest release.
+var latestReleaseURL = "https://api.github.com/repos/Vulnpire/gcpenum/releases/latest"
+
+// updateCheckTimeout bounds the -check-update request, so a slow or
+// unreachable GitHub never holds anything up.
+const updateCheckTimeout = 5 * time.Second
+
+// checkUpdate looks up the latest release and logs a notice when it is newer
+// than this build. It only reports; installing is left to the user. Errors
+// are logged at debug level, since the check is a convenience.
+func checkUpdate(transport http.RoundTripper) {
+	client := &http.Client{Transport: transport, Timeout: updateCheckTimeout}
+	latest, page, err := latestRelease(client)
+	if err != nil {
+		slog.Debug("Update check failed", "err", err)
+		return
+	}
+	switch {
+	case version == "dev":
+		slog.Info("Running a development build", "latest", latest, "url", page)
+	case compareVersions(latest, version) > 0:
+		slog.Warn("A newer version is available", "current", version, "latest", latest, "url", page)
+	default:
+		slog.Debug("Up to date", "version", version)
+	}
+}
+
+func latestRelease(client *http.Client) (tag, page string, err error) {
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("releases API returned %s", resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil || release.TagName == "" {
+		return "", "", fmt.Errorf("releases API returned no tag")
+	}
+	return release.TagName, release.HTMLURL, nil
+}
+
+// compareVersions compares two dotted versions such as v1.4.2, ignoring a
+// leading v and any pre-release or build suffix. Missing components count
+// as zero.
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, field := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(field)
+		parts = append(parts, n)
+	}
+	return parts
+}
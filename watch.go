@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Access transitions reported on top of a classification change, for
+// buckets that became listable by anyone or stopped being so.
+const (
+	TransitionNewlyPublic  = "NEWLY_PUBLIC"
+	TransitionNewlyPrivate = "NEWLY_PRIVATE"
+)
+
+// accessTransition names the access change between two classifications of
+// a bucket, or returns "" if its access did not flip. Buckets that vanish
+// or stop answering are not private, so they count as neither.
+func accessTransition(prev, cur string) string {
+	private := func(class string) bool {
+		return class == ClassExists || class == ClassRequesterPays || class == ClassAuthRequired
+	}
+	switch {
+	case private(prev) && cur == ClassListable:
+		return TransitionNewlyPublic
+	case prev == ClassListable && private(cur):
+		return TransitionNewlyPrivate
+	}
+	return ""
+}
+
+// noteTransition records on r its access transition from prev, last seen
+// at prevSeen, if there is one.
+func noteTransition(r *Result, prev string, prevSeen time.Time) {
+	if r.Transition = accessTransition(prev, r.Classification); r.Transition == "" {
+		return
+	}
+	r.TransitionAt = time.Now().UTC().Format(time.RFC3339)
+	r.PreviousSeen = prevSeen.UTC().Format(time.RFC3339)
+}
+
+// watcher diffs the findings of consecutive -watch rounds. The first round
+// is the baseline and is reported in full; later rounds only report buckets
+// whose classification changed, appeared or disappeared.
+type watcher struct {
+	round    int
+	previous map[string]Result
+	current  map[string]Result
+	// failed holds buckets whose probe errored this round; they keep their
+	// previous state instead of counting as gone.
+	failed map[string]bool
+	// started and previousStarted are when this and the previous round
+	// began, the time a previous state was last seen.
+	started         time.Time
+	previousStarted time.Time
+}
+
+func newWatcher() *watcher {
+	return &watcher{previous: make(map[string]Result)}
+}
+
+// startRound resets the state collected for the round about to run.
+func (w *watcher) startRound() {
+	w.round++
+	w.previousStarted, w.started = w.started, time.Now()
+	w.current = make(map[string]Result)
+	w.failed = make(map[string]bool)
+}
+
+// observe records r and reports whether it should be emitted, setting its
+// Change field to describe what differs from the previous round.
+func (w *watcher) observe(r Result) (Result, bool) {
+	if r.Classification == ClassError || verboseOnly(r.Classification) {
+		w.failed[r.Bucket] = true
+		return r, w.round == 1
+	}
+	w.current[r.Bucket] = r
+	if w.round == 1 {
+		return r, true
+	}
+	prev, seen := w.previous[r.Bucket]
+	switch {
+	case !seen:
+		r.Change = "new"
+	case prev.Classification != r.Classification:
+		r.Change = fmt.Sprintf("%s -> %s", prev.Classification, r.Classification)
+		noteTransition(&r, prev.Classification, w.previousStarted)
+	default:
+		return r, false
+	}
+	return r, true
+}
+
+// endRound returns the findings of the previous round that did not show up
+// again, marked as removed, and makes this round the new baseline.
+func (w *watcher) endRound() []Result {
+	var removed []Result
+	for bucket, prev := range w.previous {
+		if _, ok := w.current[bucket]; ok {
+			continue
+		}
+		if w.failed[bucket] {
+			w.current[bucket] = prev
+			continue
+		}
+		prev.Change = "removed"
+		removed = append(removed, prev)
+	}
+	w.previous = w.current
+	return removed
+}
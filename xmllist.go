@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// maxXMLListingBytes bounds a single XML listing page, which unlike JSON
+// pages is decoded as a whole.
+const maxXMLListingBytes = 64 << 20
+
+// xmlListing is the subset of a ListObjectsV2 ListBucketResult we read.
+type xmlListing struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+		Size string `xml:"Size"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// xmlListingURL returns the XML API listing URL of bucket, continuing from
+// token unless it is empty.
+func (s *scanner) xmlListingURL(bucket, token string) string {
+	params := url.Values{"list-type": {"2"}}
+	if token != "" {
+		params.Set("continuation-token", token)
+	}
+	if size := atomic.LoadInt64(&s.pageSize); size > 0 {
+		params.Set("max-keys", strconv.FormatInt(size, 10))
+	}
+	if s.delimiter != "" {
+		params.Set("delimiter", s.delimiter)
+	}
+	return fmt.Sprintf("%s/%s?%s", storageHost, bucket, params.Encode())
+}
+
+// listViaXML tries the XML API listing of a bucket the JSON API refused to
+// list, as some buckets grant anonymous listing on that interface only. When
+// it succeeds the bucket becomes LISTABLE, and a job for the remaining pages
+// is returned if there are any.
+func (s *scanner) listViaXML(result *Result) *listJob {
+	resp, err := s.getAs(classListing, s.xmlListingURL(result.Bucket, ""))
+	if err != nil {
+		slog.Debug("XML listing probe failed", "bucket", result.Bucket, "err", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	result.ListedVia = "xml"
+	if token := s.listXMLObjects(result, resp.Body); token != "" {
+		return &listJob{xml: true, pageToken: token}
+	}
+	return nil
+}
+
+// listXMLPage fetches one page of an XML API listing into result, like
+// listPage does for the JSON API.
+func (s *scanner) listXMLPage(result *Result, token string) (string, error) {
+	resp, err := s.getAs(classListing, s.xmlListingURL(result.Bucket, token))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		result.Error = fmt.Sprintf("Listing %s stopped early with status %d", result.Bucket, resp.StatusCode)
+		return "", nil
+	}
+	return s.listXMLObjects(result, resp.Body), nil
+}
+
+// listXMLObjects decodes one ListBucketResult page into result and returns
+// the continuation token of the next one. Objects are added the same way as
+// JSON listings, with the ETag standing in for md5Hash so duplicates are
+// still recognised.
+func (s *scanner) listXMLObjects(result *Result, body io.Reader) string {
+	var listing xmlListing
+	if err := xml.NewDecoder(io.LimitReader(body, maxXMLListingBytes)).Decode(&listing); err != nil {
+		result.Error = fmt.Sprintf("Could not parse XML object list for %s - %v", result.Bucket, err)
+		if result.ObjectCount > 0 {
+			result.Classification = ClassListable
+		}
+		return ""
+	}
+	result.Classification = ClassListable
+	for _, item := range listing.Contents {
+		s.addObject(result, Object{Name: item.Key, MD5Hash: etagMD5(item.ETag), Size: item.Size})
+	}
+	for _, prefix := range listing.CommonPrefixes {
+		result.Prefixes = append(result.Prefixes, prefix.Prefix)
+	}
+	if !listing.IsTruncated {
+		return ""
+	}
+	return listing.NextContinuationToken
+}
+
+// etagMD5 converts the ETag of an XML listing entry to the base64 form of
+// the JSON API's md5Hash. Composite objects have no MD5 and yield "".
+func etagMD5(etag string) string {
+	sum, err := hex.DecodeString(strings.Trim(etag, `"`))
+	if err != nil || len(sum) != 16 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}